@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strconv"
+
+	"github.com/claucece/KEMTLS-local-measurements/measure"
+)
+
+// certFlags select the certificate chains the peers authenticate with.
+type certFlags struct {
+	dir      string
+	chains   string
+	sendRoot string
+}
+
+func (cf *certFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&cf.dir, "certs", "", "directory written by gencert, fresh certificates for every run if empty")
+	fs.StringVar(&cf.chains, "chain", "default", "comma-separated chains to generate, each the schemes from the root to the leaf separated by /")
+	fs.StringVar(&cf.sendRoot, "send-root", "false", "comma-separated booleans, whether the root is sent after the intermediates")
+}
+
+// list returns every combination of the chains and -send-root values.
+func (cf *certFlags) list() []measure.Chain {
+	var chains []measure.Chain
+	for _, spec := range splitList(cf.chains) {
+		c, err := measure.ParseChain(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, v := range splitList(cf.sendRoot) {
+			c.SendRoot, err = strconv.ParseBool(v)
+			if err != nil {
+				log.Fatalf("invalid -send-root value %q", v)
+			}
+			chains = append(chains, c)
+		}
+	}
+	if len(chains) == 0 {
+		chains = append(chains, measure.Chain{})
+	}
+	return chains
+}
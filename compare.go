@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/claucece/KEMTLS-local-measurements/measure"
+)
+
+// compareCommand compares two files of exported records, e.g. before and
+// after updating the Go fork, and exits with status 1 on a regression.
+func compareCommand(args []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: compare [flags] old new")
+		fs.PrintDefaults()
+	}
+	alpha := fs.Float64("alpha", 0.05, "significance level of the Mann-Whitney U test")
+	threshold := fs.Float64("threshold", 0.05, "slowdown of the median, as a fraction, beyond which a significant change is a regression")
+	columns := fs.String("columns", "", "comma-separated duration columns to compare, e.g. client_FullProtocol_ns; all if empty")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	before := readRecords(fs.Arg(0))
+	after := readRecords(fs.Arg(1))
+	cs, unmatched := measure.Compare(before, after, splitList(*columns))
+	measure.PrintStepComparisons(os.Stdout, cs, *alpha, *threshold)
+	for _, k := range unmatched {
+		log.Printf("only in one file: %s", k)
+	}
+
+	regressions := 0
+	for _, c := range cs {
+		if c.Regression(*alpha, *threshold) {
+			regressions++
+		}
+	}
+	if regressions > 0 {
+		log.Printf("%d regressions beyond %.1f%%", regressions, 100**threshold)
+		os.Exit(1)
+	}
+}
+
+// readRecords reads the exported records in the file name.
+func readRecords(name string) *measure.RecordSet {
+	f, err := os.Open(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	rs, err := measure.ReadRecords(f)
+	if err != nil {
+		log.Fatalf("%s: %v", name, err)
+	}
+	return rs
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/claucece/KEMTLS-local-measurements/measure"
+)
+
+// gencertCommand writes a fresh root, intermediates and DC-enabled leaf to
+// a directory that run and sweep can load with -certs.
+func gencertCommand(args []string) {
+	opts := measure.DefaultCertOptions()
+	fs := flag.NewFlagSet("gencert", flag.ExitOnError)
+	dir := fs.String("dir", "certs", "directory to write the certificates and keys to")
+	scheme := fs.String("scheme", measure.SchemeName(opts.Scheme), "signature scheme of the keys in the chain")
+	fs.IntVar(&opts.Intermediates, "intermediates", 0, "number of intermediate CAs between the root and the leaf")
+	chain := fs.String("chain", "", "schemes from the root to the leaf separated by /, overriding -scheme and -intermediates")
+	hosts := fs.String("hosts", "127.0.0.1,localhost", "comma-separated DNS names and IP addresses of the leaf")
+	fs.DurationVar(&opts.ValidFor, "valid-for", opts.ValidFor, "validity period of the certificates")
+	fs.Parse(args)
+
+	var err error
+	opts.Scheme, err = measure.ParseScheme(*scheme)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := measure.CheckCertScheme(opts.Scheme); err != nil {
+		log.Fatal(err)
+	}
+	opts.Hosts = splitList(*hosts)
+	c, err := measure.ParseChain(*chain)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts.Schemes = c.Schemes
+
+	certs, err := measure.GenerateCerts(opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := certs.WriteDir(*dir); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Wrote a chain of %d certificates to %s", len(certs.Leaf.Certificate)+1, *dir)
+}
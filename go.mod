@@ -0,0 +1,3 @@
+module github.com/claucece/KEMTLS-local-measurements
+
+go 1.16
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/claucece/KEMTLS-local-measurements/measure"
+)
+
+// httpCommand loads a page over HTTP/1.1 and HTTP/2 from a local server
+// with each protocol family, to see what the handshakes cost a page.
+func httpCommand(args []string) {
+	fs := flag.NewFlagSet("http", flag.ExitOnError)
+	protocols := fs.String("protocols", "tls13,pqtls,kemtls,kemtls-pdk", "comma-separated protocol families")
+	authFlag := fs.String("auth", "server-only", "authentication mode: server-only or mutual")
+	versions := fs.String("http", "1.1,2", "comma-separated HTTP versions: 1.1 or 2")
+	resources := fs.String("resources", "14000,2000x8", "comma-separated resource sizes in bytes, the document first; sizexcount repeats a size")
+	pages := fs.Int("pages", 20, "number of page loads, each with new handshakes")
+	var certs certFlags
+	certs.register(fs)
+	var network networkFlags
+	network.register(fs)
+	fs.Parse(args)
+
+	auth, err := measure.ParseAuthMode(*authFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sizes, err := measure.ParseResources(*resources)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var results []measure.HTTPResult
+	for _, name := range splitList(*protocols) {
+		protocol, err := measure.ParseProtocol(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, chain := range certs.list() {
+			for _, link := range network.links() {
+				s := measure.DefaultScenario(protocol, auth)
+				s.CertDir = certs.dir
+				s.Chain = chain
+				s.Link = link
+
+				for _, version := range splitList(*versions) {
+					opts := measure.HTTPOptions{Version: version, Resources: sizes, Pages: *pages}
+					hr, err := measure.HTTPTest(s, opts)
+					if err != nil {
+						log.Fatalf("%v: %v", s, err)
+					}
+					if hr.FirstErr != nil {
+						log.Printf("%v over HTTP/%s: %d failed page loads, the first with: %v", s, version, hr.Errors, hr.FirstErr)
+					}
+					results = append(results, hr)
+				}
+			}
+		}
+	}
+
+	measure.PrintHTTP(os.Stdout, results)
+}
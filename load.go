@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/claucece/KEMTLS-local-measurements/measure"
+)
+
+// loadCommand runs a closed-loop load test of each protocol family against
+// a long-lived server or, with -rate, open-loop tests at increasing arrival
+// rates to find where the server saturates.
+func loadCommand(args []string) {
+	fs := flag.NewFlagSet("load", flag.ExitOnError)
+	protocols := fs.String("protocols", "tls13,pqtls,kemtls,kemtls-pdk", "comma-separated protocol families")
+	authFlag := fs.String("auth", "server-only", "authentication mode: server-only or mutual")
+	clients := fs.String("clients", "8", "comma-separated numbers of concurrent clients, each measured separately")
+	rates := fs.String("rate", "", "comma-separated arrival rates in handshakes per second, for open-loop tests instead of -clients")
+	poisson := fs.Bool("poisson", false, "with -rate, space the arrivals exponentially instead of evenly")
+	duration := fs.Duration("duration", 10*time.Second, "measured duration of each test")
+	warmup := fs.Duration("warmup", time.Second, "duration to run and discard before measuring")
+	var certs certFlags
+	certs.register(fs)
+	var network networkFlags
+	network.register(fs)
+	fs.Parse(args)
+
+	auth, err := measure.ParseAuthMode(*authFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var loads []measure.LoadOptions
+	if *rates != "" {
+		var values []float64
+		for _, r := range splitList(*rates) {
+			v, err := strconv.ParseFloat(r, 64)
+			if err != nil || v <= 0 {
+				log.Fatalf("invalid rate %q", r)
+			}
+			values = append(values, v)
+		}
+		sort.Float64s(values)
+		for _, v := range values {
+			loads = append(loads, measure.LoadOptions{Rate: v, Poisson: *poisson})
+		}
+	} else {
+		for _, c := range splitList(*clients) {
+			n, err := strconv.Atoi(c)
+			if err != nil || n < 1 {
+				log.Fatalf("invalid number of clients %q", c)
+			}
+			loads = append(loads, measure.LoadOptions{Clients: n})
+		}
+	}
+
+	var results []measure.LoadResult
+	var knees []string
+	for _, name := range splitList(*protocols) {
+		protocol, err := measure.ParseProtocol(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, chain := range certs.list() {
+			for _, link := range network.links() {
+				s := measure.DefaultScenario(protocol, auth)
+				s.CertDir = certs.dir
+				s.Chain = chain
+				s.Link = link
+				tests := loadTests(s, loads, *duration, *warmup)
+				results = append(results, tests...)
+
+				if *rates != "" && len(tests) > 0 {
+					knees = append(knees, knee(s, tests))
+				}
+			}
+		}
+	}
+
+	measure.PrintLoad(os.Stdout, results)
+	for _, k := range knees {
+		fmt.Println(k)
+	}
+}
+
+// loadTests runs a load test of s with each of loads, logging the failures.
+func loadTests(s measure.Scenario, loads []measure.LoadOptions, duration, warmup time.Duration) []measure.LoadResult {
+	var tests []measure.LoadResult
+	for _, opts := range loads {
+		opts.Duration = duration
+		opts.Warmup = warmup
+		lr, err := measure.LoadTest(s, opts)
+		if err != nil {
+			log.Printf("%v: %v", s, err)
+			continue
+		}
+		if lr.FirstErr != nil {
+			log.Printf("%v at %v: %d failed handshakes, the first with: %v", s, opts, lr.Errors, lr.FirstErr)
+		}
+		if lr.FirstDialErr != nil {
+			log.Printf("%v at %v: %d connections could not be opened, the first with: %v", s, opts, lr.DialErrors, lr.FirstDialErr)
+		}
+		tests = append(tests, lr)
+	}
+	return tests
+}
+
+// knee describes where s saturates in tests, open-loop tests by increasing
+// rate.
+func knee(s measure.Scenario, tests []measure.LoadResult) string {
+	switch knee := measure.Knee(tests); {
+	case knee < 0:
+		return fmt.Sprintf("%v: not saturated up to %v", s, tests[len(tests)-1].Options)
+	case knee == 0:
+		return fmt.Sprintf("%v: already saturated at %v", s, tests[0].Options)
+	default:
+		return fmt.Sprintf("%v: saturates between %v and %v", s, tests[knee-1].Options, tests[knee].Options)
+	}
+}
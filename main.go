@@ -0,0 +1,66 @@
+// Command KEMTLS-local-measurements runs TLS 1.3, PQTLS, KEMTLS or
+// KEMTLS-PDK handshakes over a local connection and prints their timings.
+//
+// Usage:
+//
+//	KEMTLS-local-measurements [run] [flags]
+//	KEMTLS-local-measurements sweep [flags]
+//	KEMTLS-local-measurements gencert [flags]
+//	KEMTLS-local-measurements primitives [flags]
+//	KEMTLS-local-measurements load [flags]
+//	KEMTLS-local-measurements http [flags]
+//	KEMTLS-local-measurements compare [flags] old new
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/claucece/KEMTLS-local-measurements/measure"
+)
+
+var commands = map[string]func(args []string){
+	"run":        runCommand,
+	"sweep":      sweepCommand,
+	"gencert":    gencertCommand,
+	"primitives": primitivesCommand,
+	"load":       loadCommand,
+	"http":       httpCommand,
+	"compare":    compareCommand,
+}
+
+func main() {
+	args := os.Args[1:]
+	name := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+		os.Exit(2)
+	}
+	cmd(args)
+}
+
+func logOutcome(s measure.Scenario, err error, succeeded bool) {
+	// Resumed handshakes authenticate with the session's PSK, not with a
+	// delegated credential, and s names their resumption mode.
+	withDC, withDCs := " with dc", " with dcs"
+	if s.Resumption != measure.NoResumption {
+		withDC, withDCs = "", ""
+	}
+	if err != nil {
+		log.Println("")
+		log.Println(err.Error())
+	} else if !succeeded {
+		log.Println("")
+		log.Printf("Failure while trying to use %v%s", s, withDCs)
+	} else {
+		log.Println("")
+		log.Printf("Success using %v%s", s, withDC)
+	}
+}
@@ -0,0 +1,116 @@
+package measure
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// The names below are the ones accepted on the command line. The stringers
+// shipped with crypto/tls do not know about the post-quantum identifiers, so
+// they are kept here.
+var curveNames = []struct {
+	id          tls.CurveID
+	name        string
+	postQuantum bool
+}{
+	{tls.X25519, "X25519", false},
+	{tls.CurveP256, "P256", false},
+	{tls.CurveP384, "P384", false},
+	{tls.CurveP521, "P521", false},
+	{tls.SIKEp434, "SIKEp434", true},
+	{tls.Kyber512, "Kyber512", true},
+}
+
+// schemeKind tells which protocol family can use a delegated credential
+// scheme.
+type schemeKind int
+
+const (
+	classicalSignature schemeKind = iota
+	pqSignature                   // PQTLS
+	kemAuthentication             // KEMTLS
+)
+
+var schemeNames = []struct {
+	scheme tls.SignatureScheme
+	name   string
+	kind   schemeKind
+}{
+	{tls.ECDSAWithP256AndSHA256, "ECDSAWithP256AndSHA256", classicalSignature},
+	{tls.ECDSAWithP384AndSHA384, "ECDSAWithP384AndSHA384", classicalSignature},
+	{tls.ECDSAWithP521AndSHA512, "ECDSAWithP521AndSHA512", classicalSignature},
+	{tls.Ed25519, "Ed25519", classicalSignature},
+	{tls.Ed448, "Ed448", classicalSignature},
+	{tls.KEMTLSWithSIKEp434, "KEMTLSWithSIKEp434", kemAuthentication},
+	{tls.KEMTLSWithKyber512, "KEMTLSWithKyber512", kemAuthentication},
+	{tls.PQTLSWithDilithium3, "PQTLSWithDilithium3", pqSignature},
+}
+
+// CurveName returns the name of a key exchange group.
+func CurveName(id tls.CurveID) string {
+	for _, c := range curveNames {
+		if c.id == id {
+			return c.name
+		}
+	}
+	return fmt.Sprintf("CurveID(%d)", id)
+}
+
+// curveList returns the names of groups joined with sep.
+func curveList(groups []tls.CurveID, sep string) string {
+	names := make([]string, len(groups))
+	for i, g := range groups {
+		names[i] = CurveName(g)
+	}
+	return strings.Join(names, sep)
+}
+
+// ParseCurve returns the key exchange group with the given name.
+func ParseCurve(name string) (tls.CurveID, error) {
+	for _, c := range curveNames {
+		if c.name == name {
+			return c.id, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown key exchange group %q", name)
+}
+
+// SchemeName returns the name of a signature (or KEM authentication) scheme.
+func SchemeName(scheme tls.SignatureScheme) string {
+	for _, s := range schemeNames {
+		if s.scheme == scheme {
+			return s.name
+		}
+	}
+	return fmt.Sprintf("SignatureScheme(%#04x)", uint16(scheme))
+}
+
+// ParseScheme returns the signature scheme with the given name.
+func ParseScheme(name string) (tls.SignatureScheme, error) {
+	for _, s := range schemeNames {
+		if s.name == name {
+			return s.scheme, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown signature scheme %q", name)
+}
+
+func isPostQuantumCurve(id tls.CurveID) bool {
+	for _, c := range curveNames {
+		if c.id == id {
+			return c.postQuantum
+		}
+	}
+	return false
+}
+
+// kindOf returns the kind of scheme and whether it is known.
+func kindOf(scheme tls.SignatureScheme) (schemeKind, bool) {
+	for _, s := range schemeNames {
+		if s.scheme == scheme {
+			return s.kind, true
+		}
+	}
+	return 0, false
+}
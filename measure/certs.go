@@ -0,0 +1,351 @@
+package measure
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"circl/sign"
+	signschemes "circl/sign/schemes"
+)
+
+// delegationUsageOID is the DelegationUsage extension, which allows a
+// certificate to issue delegated credentials, see
+// draft-ietf-tls-subcerts, Section 4.2.
+var delegationUsageOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 44363, 44}
+
+// The files written by Certs.WriteDir and read by LoadCerts.
+const (
+	rootCertFile = "root.crt"
+	rootKeyFile  = "root.key"
+	leafCertFile = "leaf.crt" // the leaf followed by the intermediates
+	leafKeyFile  = "leaf.key"
+)
+
+// CertOptions configures the certificates issued by GenerateCerts.
+type CertOptions struct {
+	// Scheme is the signature scheme of every key in the chain. Delegated
+	// credentials of any scheme are issued from the leaf at run time, so the
+	// chain itself only needs a scheme crypto/x509 can sign with.
+	Scheme tls.SignatureScheme
+
+	// Intermediates is the number of CAs between the root and the leaf.
+	Intermediates int
+
+	// Schemes, if set, overrides Scheme and Intermediates with the scheme
+	// of each level, from the root to the leaf.
+	Schemes []tls.SignatureScheme
+
+	// Hosts are the DNS names and IP addresses the leaf is valid for.
+	Hosts []string
+
+	// ValidFor is the validity period of every certificate.
+	ValidFor time.Duration
+}
+
+// DefaultCertOptions returns a P-256 root directly issuing a leaf for
+// 127.0.0.1 and localhost, valid for a year.
+func DefaultCertOptions() CertOptions {
+	return CertOptions{
+		Scheme:   tls.ECDSAWithP256AndSHA256,
+		Hosts:    []string{"127.0.0.1", "localhost"},
+		ValidFor: 365 * 24 * time.Hour,
+	}
+}
+
+// Certs is a root CA and a DC-enabled leaf chaining to it, possibly through
+// intermediates. Both peers authenticate with the same leaf.
+type Certs struct {
+	Root *x509.Certificate
+
+	// Leaf holds the leaf certificate followed by the intermediates, from
+	// the one that issued the leaf up, and its key. Leaf.Leaf is parsed.
+	Leaf tls.Certificate
+
+	// The keys of the root and of the intermediates, in Leaf order, are only
+	// known to freshly generated Certs.
+	rootKey          crypto.Signer
+	intermediateKeys []crypto.Signer
+}
+
+// roots returns a pool holding the root of c.
+func (c *Certs) roots() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.Root)
+	return pool
+}
+
+// GenerateCerts issues a fresh root, the intermediates and a leaf carrying
+// the DelegationUsage extension, as described by opts.
+func GenerateCerts(opts CertOptions) (*Certs, error) {
+	schemes := opts.Schemes
+	if schemes == nil {
+		if opts.Intermediates < 0 {
+			return nil, errors.New("the number of intermediates cannot be negative")
+		}
+		for i := 0; i < opts.Intermediates+2; i++ {
+			schemes = append(schemes, opts.Scheme)
+		}
+	}
+	if len(schemes) < 2 {
+		return nil, errors.New("a chain needs at least a root and a leaf")
+	}
+	notBefore := time.Now().Add(-time.Hour)
+	notAfter := notBefore.Add(opts.ValidFor)
+
+	rootKey, err := generateKey(schemes[0])
+	if err != nil {
+		return nil, err
+	}
+	rootTemplate := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "KEMTLS measurements root"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	root, err := issue(rootTemplate, rootTemplate, rootKey, rootKey)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Certs{Root: root, rootKey: rootKey}
+	issuer, issuerKey := root, rootKey
+	var chain [][]byte
+	for i, scheme := range schemes[1 : len(schemes)-1] {
+		key, err := generateKey(scheme)
+		if err != nil {
+			return nil, err
+		}
+		cert, err := issue(&x509.Certificate{
+			Subject:               pkix.Name{CommonName: fmt.Sprintf("KEMTLS measurements intermediate %d", i+1)},
+			NotBefore:             notBefore,
+			NotAfter:              notAfter,
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}, issuer, key, issuerKey)
+		if err != nil {
+			return nil, err
+		}
+		chain = append([][]byte{cert.Raw}, chain...)
+		c.intermediateKeys = append([]crypto.Signer{key}, c.intermediateKeys...)
+		issuer, issuerKey = cert, key
+	}
+
+	leafKey, err := generateKey(schemes[len(schemes)-1])
+	if err != nil {
+		return nil, err
+	}
+	leafTemplate := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "KEMTLS measurements leaf"},
+		NotBefore:   notBefore,
+		NotAfter:    notAfter,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		ExtraExtensions: []pkix.Extension{
+			{Id: delegationUsageOID, Value: asn1.NullBytes},
+		},
+	}
+	for _, h := range opts.Hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			leafTemplate.IPAddresses = append(leafTemplate.IPAddresses, ip)
+		} else {
+			leafTemplate.DNSNames = append(leafTemplate.DNSNames, h)
+		}
+	}
+	leaf, err := issue(leafTemplate, issuer, leafKey, issuerKey)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Leaf = tls.Certificate{
+		Certificate: append([][]byte{leaf.Raw}, chain...),
+		PrivateKey:  leafKey,
+		Leaf:        leaf,
+	}
+	return c, nil
+}
+
+// CheckCertScheme returns an error if certificates cannot be issued with
+// scheme: the ECDSA schemes, Ed25519 and the circl signature schemes can
+// sign them, but KEM keys cannot sign, so the KEMTLS schemes are limited to
+// delegated credentials.
+func CheckCertScheme(scheme tls.SignatureScheme) error {
+	switch scheme {
+	case tls.ECDSAWithP256AndSHA256, tls.ECDSAWithP384AndSHA384, tls.ECDSAWithP521AndSHA512, tls.Ed25519:
+		return nil
+	}
+	if kind, _ := kindOf(scheme); kind == kemAuthentication {
+		return fmt.Errorf("cannot issue certificates with %s keys, only delegated credentials", SchemeName(scheme))
+	}
+	if signScheme(scheme) == nil {
+		return fmt.Errorf("cannot issue certificates with %s keys: no signature implementation available", SchemeName(scheme))
+	}
+	return nil
+}
+
+// signSchemeNames lists the circl schemes implementing each non-ECDSA
+// signature scheme, tried in order.
+var signSchemeNames = map[tls.SignatureScheme][]string{
+	tls.Ed25519:             {"Ed25519"},
+	tls.Ed448:               {"Ed448"},
+	tls.PQTLSWithDilithium3: {"Dilithium3"},
+}
+
+// signScheme returns the circl scheme implementing id, nil if there is none.
+func signScheme(id tls.SignatureScheme) sign.Scheme {
+	for _, n := range signSchemeNames[id] {
+		if scheme := signschemes.ByName(n); scheme != nil {
+			return scheme
+		}
+	}
+	return nil
+}
+
+// generateKey returns a new private key for scheme. The keys of the circl
+// schemes are crypto.Signers, and whether crypto/x509 can issue
+// certificates with them is only known when it is asked to.
+func generateKey(scheme tls.SignatureScheme) (crypto.Signer, error) {
+	switch scheme {
+	case tls.ECDSAWithP256AndSHA256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case tls.ECDSAWithP384AndSHA384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case tls.ECDSAWithP521AndSHA512:
+		return ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case tls.Ed25519:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	}
+	if err := CheckCertScheme(scheme); err != nil {
+		return nil, err
+	}
+	_, priv, err := signScheme(scheme).GenerateKey()
+	if err != nil {
+		return nil, fmt.Errorf("generating %s key: %v", SchemeName(scheme), err)
+	}
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s keys cannot sign certificates", SchemeName(scheme))
+	}
+	return signer, nil
+}
+
+// issue signs template with issuerKey, as issuer, for the public half of key.
+func issue(template, issuer *x509.Certificate, key, issuerKey crypto.Signer) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	template.SerialNumber = serial
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, key.Public(), issuerKey)
+	if err != nil {
+		return nil, fmt.Errorf("issuing %q: %v", template.Subject.CommonName, err)
+	}
+	return x509.ParseCertificate(der)
+}
+
+// WriteDir writes the certificates and the keys known to c as PEM files in
+// dir, creating it if needed. The intermediates are also written one per
+// file, intermediate1.crt being the one issued by the root.
+func (c *Certs) WriteDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := writePEM(filepath.Join(dir, rootCertFile), 0644, "CERTIFICATE", c.Root.Raw); err != nil {
+		return err
+	}
+	if c.rootKey != nil {
+		if err := writeKey(filepath.Join(dir, rootKeyFile), c.rootKey); err != nil {
+			return err
+		}
+	}
+
+	intermediates := c.Leaf.Certificate[1:]
+	for i := range intermediates {
+		// Leaf order starts from the leaf, the files from the root.
+		j := len(intermediates) - 1 - i
+		name := filepath.Join(dir, fmt.Sprintf("intermediate%d", i+1))
+		if err := writePEM(name+".crt", 0644, "CERTIFICATE", intermediates[j]); err != nil {
+			return err
+		}
+		if j < len(c.intermediateKeys) {
+			if err := writeKey(name+".key", c.intermediateKeys[j]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := writePEM(filepath.Join(dir, leafCertFile), 0644, "CERTIFICATE", c.Leaf.Certificate...); err != nil {
+		return err
+	}
+	return writeKey(filepath.Join(dir, leafKeyFile), c.Leaf.PrivateKey)
+}
+
+func writeKey(name string, key crypto.PrivateKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return writePEM(name, 0600, "PRIVATE KEY", der)
+}
+
+func writePEM(name string, perm os.FileMode, typ string, blocks ...[]byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	for _, b := range blocks {
+		if err := pem.Encode(f, &pem.Block{Type: typ, Bytes: b}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// LoadCerts reads the root and the leaf chain written to dir by WriteDir.
+func LoadCerts(dir string) (*Certs, error) {
+	rootPEM, err := ioutil.ReadFile(filepath.Join(dir, rootCertFile))
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(rootPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%s: no certificate found", filepath.Join(dir, rootCertFile))
+	}
+	root, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := tls.LoadX509KeyPair(filepath.Join(dir, leafCertFile), filepath.Join(dir, leafKeyFile))
+	if err != nil {
+		return nil, err
+	}
+	leaf.Leaf, err = x509.ParseCertificate(leaf.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return &Certs{Root: root, Leaf: leaf}, nil
+}
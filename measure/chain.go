@@ -0,0 +1,104 @@
+package measure
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Chain is the shape of the certificate chain generated for a scenario.
+type Chain struct {
+	// Schemes is the signature scheme of each level, from the root to the
+	// leaf, so a chain with N intermediates has N+2 schemes. Nil means the
+	// chain of DefaultCertOptions.
+	Schemes []tls.SignatureScheme
+
+	// SendRoot makes the peers send the root after the intermediates, as
+	// some deployments do, although the verifier already has it.
+	SendRoot bool
+}
+
+// ParseChain parses the schemes of a chain, from the root to the leaf,
+// separated by "/", e.g. "Ed25519/ECDSAWithP256AndSHA256". An empty spec or
+// "default" is the default chain. Every level must be a scheme certificates
+// can be issued with.
+func ParseChain(spec string) (Chain, error) {
+	var c Chain
+	if spec == "" || spec == "default" {
+		return c, nil
+	}
+	for _, name := range strings.Split(spec, "/") {
+		scheme, err := ParseScheme(name)
+		if err != nil {
+			return c, err
+		}
+		if err := CheckCertScheme(scheme); err != nil {
+			return c, fmt.Errorf("chain %q: %v", spec, err)
+		}
+		c.Schemes = append(c.Schemes, scheme)
+	}
+	if len(c.Schemes) < 2 {
+		return c, fmt.Errorf("chain %q needs at least a root and a leaf", spec)
+	}
+	return c, nil
+}
+
+func (c Chain) isZero() bool {
+	return c.Schemes == nil && !c.SendRoot
+}
+
+func (c Chain) String() string {
+	str := "default"
+	if c.Schemes != nil {
+		names := make([]string, len(c.Schemes))
+		for i, scheme := range c.Schemes {
+			names[i] = SchemeName(scheme)
+		}
+		str = strings.Join(names, "/")
+	}
+	if c.SendRoot {
+		str += "+root"
+	}
+	return str
+}
+
+var (
+	generatedMu    sync.Mutex
+	generatedCerts = map[string]*Certs{}
+)
+
+// certs returns the certificates of s: the ones in CertDir if set, otherwise
+// ones generated for s.Chain once for the lifetime of the process.
+func (s Scenario) certs() (*Certs, error) {
+	if s.CertDir != "" {
+		return LoadCerts(s.CertDir)
+	}
+
+	// SendRoot does not change the chain that is generated.
+	key := Chain{Schemes: s.Chain.Schemes}.String()
+	generatedMu.Lock()
+	defer generatedMu.Unlock()
+	if c, ok := generatedCerts[key]; ok {
+		return c, nil
+	}
+
+	opts := DefaultCertOptions()
+	opts.Schemes = s.Chain.Schemes
+	c, err := GenerateCerts(opts)
+	if err != nil {
+		return nil, err
+	}
+	generatedCerts[key] = c
+	return c, nil
+}
+
+// certificate returns the certificate the peers of s authenticate with,
+// ending with the root if s.Chain.SendRoot is set.
+func (s Scenario) certificate(certs *Certs) tls.Certificate {
+	cert := certs.Leaf
+	if s.Chain.SendRoot {
+		cert.Certificate = append(cert.Certificate[:len(cert.Certificate):len(cert.Certificate)], certs.Root.Raw)
+	}
+	return cert
+}
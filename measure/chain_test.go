@@ -0,0 +1,37 @@
+package measure
+
+import (
+	"crypto/tls"
+	"reflect"
+	"testing"
+)
+
+func TestParseChain(t *testing.T) {
+	for _, tt := range []struct {
+		spec string
+		want []tls.SignatureScheme
+		ok   bool
+	}{
+		{"", nil, true},
+		{"default", nil, true},
+		{"Ed25519/ECDSAWithP256AndSHA256", []tls.SignatureScheme{tls.Ed25519, tls.ECDSAWithP256AndSHA256}, true},
+		{
+			"ECDSAWithP384AndSHA384/Ed25519/ECDSAWithP256AndSHA256",
+			[]tls.SignatureScheme{tls.ECDSAWithP384AndSHA384, tls.Ed25519, tls.ECDSAWithP256AndSHA256},
+			true,
+		},
+		// KEM keys cannot sign the next level, nor the delegated credential.
+		{"Ed25519/KEMTLSWithKyber512", nil, false},
+		{"Ed25519", nil, false},
+		{"Ed25519/Falcon512", nil, false},
+	} {
+		c, err := ParseChain(tt.spec)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseChain(%q) error = %v, want ok = %v", tt.spec, err, tt.ok)
+			continue
+		}
+		if tt.ok && !reflect.DeepEqual(c.Schemes, tt.want) {
+			t.Errorf("ParseChain(%q) = %v, want %v", tt.spec, c.Schemes, tt.want)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package measure
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// RecordSet holds exported records read back, grouped by scenario: the
+// samples of every duration column of the successful handshakes.
+type RecordSet struct {
+	// Scenarios are the scenario keys, in the order they first appear.
+	Scenarios []string
+	Samples   map[string]map[string][]time.Duration
+}
+
+// scenarioColumns returns the exported columns describing the scenario.
+func scenarioColumns() []string {
+	var names []string
+	for _, f := range record(Scenario{}, 0, Result{}) {
+		if f.key {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+// ReadRecords reads records written by an Exporter in either format.
+func ReadRecords(r io.Reader) (*RecordSet, error) {
+	rs := &RecordSet{Samples: map[string]map[string][]time.Duration{}}
+	br := bufio.NewReader(r)
+	first, err := br.Peek(1)
+	if err == io.EOF {
+		return rs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keys := scenarioColumns()
+	if bytes.HasPrefix(first, []byte("{")) {
+		dec := json.NewDecoder(br)
+		for {
+			var rec map[string]interface{}
+			if err := dec.Decode(&rec); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			fields := map[string]string{}
+			for name, v := range rec {
+				if f, ok := v.(float64); ok {
+					fields[name] = strconv.FormatFloat(f, 'f', -1, 64)
+				} else {
+					fields[name] = fmt.Sprint(v)
+				}
+			}
+			if err := rs.add(fields, keys); err != nil {
+				return nil, err
+			}
+		}
+		return rs, nil
+	}
+
+	cr := csv.NewReader(br)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		fields := map[string]string{}
+		for i, name := range header {
+			fields[name] = row[i]
+		}
+		if err := rs.add(fields, keys); err != nil {
+			return nil, err
+		}
+	}
+	return rs, nil
+}
+
+// add records the durations of a successful handshake, described by the
+// scenario columns keys.
+func (rs *RecordSet) add(fields map[string]string, keys []string) error {
+	if fields["success"] != "true" {
+		return nil
+	}
+
+	isKey := map[string]bool{}
+	var key []string
+	for _, name := range keys {
+		isKey[name] = true
+		if v := keyValue(fields[name]); v != "" {
+			key = append(key, name+"="+v)
+		}
+	}
+	k := strings.Join(key, " ")
+
+	samples, ok := rs.Samples[k]
+	if !ok {
+		samples = map[string][]time.Duration{}
+		rs.Samples[k] = samples
+		rs.Scenarios = append(rs.Scenarios, k)
+	}
+
+	for name, v := range fields {
+		if !strings.HasSuffix(name, "_ns") || isKey[name] {
+			continue
+		}
+		ns, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("column %s: %v", name, err)
+		}
+		samples[name] = append(samples[name], time.Duration(ns))
+	}
+	return nil
+}
+
+// keyValue returns v, a scenario column, in the form used in the scenario
+// keys: numbers are formatted alike whatever the exporter wrote, e.g. 1e-05
+// and 0.00001, and empty for zero, like unset strings.
+func keyValue(v string) string {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return v
+	}
+	if f == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// StepComparison compares the samples of a duration column of a scenario in
+// two record sets.
+type StepComparison struct {
+	Scenario string
+	Column   string
+	Old, New Summary
+	// Change is the relative change of the median, positive when slower.
+	Change float64
+	// P is the two-sided p-value of the Mann-Whitney U test.
+	P float64
+}
+
+// Significant reports whether the distributions differ at level alpha.
+func (c StepComparison) Significant(alpha float64) bool {
+	return c.P < alpha
+}
+
+// Regression reports whether the column got significantly slower by more
+// than threshold, a fraction of the old median.
+func (c StepComparison) Regression(alpha, threshold float64) bool {
+	return c.Significant(alpha) && c.Change > threshold
+}
+
+// Compare compares every duration column of the scenarios found in both
+// before and after, restricted to columns if it is not empty. Columns that
+// are zero in both are skipped. It also returns the scenarios found in only
+// one set.
+func Compare(before, after *RecordSet, columns []string) (cs []StepComparison, unmatched []string) {
+	for _, k := range after.Scenarios {
+		if _, ok := before.Samples[k]; !ok {
+			unmatched = append(unmatched, k)
+		}
+	}
+	for _, k := range before.Scenarios {
+		newSamples, ok := after.Samples[k]
+		if !ok {
+			unmatched = append(unmatched, k)
+			continue
+		}
+		oldSamples := before.Samples[k]
+
+		names := columns
+		if len(names) == 0 {
+			for name := range oldSamples {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+		for _, name := range names {
+			o, n := oldSamples[name], newSamples[name]
+			if len(o) == 0 || len(n) == 0 {
+				continue
+			}
+			c := StepComparison{Scenario: k, Column: name, Old: Summarize(o), New: Summarize(n)}
+			if c.Old.Max == 0 && c.New.Max == 0 {
+				continue
+			}
+			if c.Old.Median > 0 {
+				c.Change = float64(c.New.Median-c.Old.Median) / float64(c.Old.Median)
+			}
+			_, c.P = mannWhitneyU(o, n)
+			cs = append(cs, c)
+		}
+	}
+	return cs, unmatched
+}
+
+// mannWhitneyU returns the U statistic of a and the two-sided p-value of the
+// Mann-Whitney U test of a and b, using the normal approximation with tie
+// and continuity corrections.
+func mannWhitneyU(a, b []time.Duration) (u, p float64) {
+	type sample struct {
+		d     time.Duration
+		fromA bool
+	}
+	all := make([]sample, 0, len(a)+len(b))
+	for _, d := range a {
+		all = append(all, sample{d, true})
+	}
+	for _, d := range b {
+		all = append(all, sample{d, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].d < all[j].d })
+
+	// Tied samples share the mean of their ranks.
+	var rankA, ties float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].d == all[i].d {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].fromA {
+				rankA += rank
+			}
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+
+	n1, n2 := float64(len(a)), float64(len(b))
+	n := n1 + n2
+	u = rankA - n1*(n1+1)/2
+	mean := n1 * n2 / 2
+	sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1))))
+	if sigma == 0 {
+		return u, 1
+	}
+	z := math.Max(math.Abs(u-mean)-0.5, 0) / sigma
+	return u, math.Erfc(z / math.Sqrt2)
+}
+
+// PrintStepComparisons writes the old and new medians, the change and the
+// p-value of every comparison in cs to w, marking the significant changes
+// with * and the regressions beyond threshold with !.
+func PrintStepComparisons(w io.Writer, cs []StepComparison, alpha, threshold float64) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Scenario\tColumn\tOld N\tOld median\tNew N\tNew median\tChange\tp\t")
+	for _, c := range cs {
+		mark := ""
+		switch {
+		case c.Regression(alpha, threshold):
+			mark = "!"
+		case c.Significant(alpha):
+			mark = "*"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%v\t%d\t%v\t%+.1f%%\t%.3g\t%s\n",
+			c.Scenario, c.Column, c.Old.N, c.Old.Median, c.New.N, c.New.Median, 100*c.Change, c.P, mark)
+	}
+	tw.Flush()
+}
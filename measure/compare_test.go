@@ -0,0 +1,81 @@
+package measure
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMannWhitneyU(t *testing.T) {
+	for _, tt := range []struct {
+		a, b []time.Duration
+		u, p float64
+	}{
+		// The p-values are those of R's wilcox.test(a, b, exact = FALSE).
+		{[]time.Duration{1, 2, 3}, []time.Duration{4, 5, 6}, 0, 0.080856},
+		{[]time.Duration{1, 2, 3, 4, 5}, []time.Duration{6, 7, 8, 9, 10}, 0, 0.012186},
+		{[]time.Duration{6, 7, 8, 9, 10}, []time.Duration{1, 2, 3, 4, 5}, 25, 0.012186},
+		{[]time.Duration{1, 3, 5, 7}, []time.Duration{2, 4, 6, 8}, 6, 0.665006},
+		// Ties share their mean rank and shrink the variance.
+		{[]time.Duration{1, 2, 2, 3}, []time.Duration{2, 3, 3, 4}, 3, 0.172034},
+		{[]time.Duration{1, 2, 3}, []time.Duration{1, 2, 3}, 4.5, 1},
+		// Nothing to rank.
+		{[]time.Duration{5, 5}, []time.Duration{5, 5, 5}, 3, 1},
+	} {
+		u, p := mannWhitneyU(tt.a, tt.b)
+		if u != tt.u || math.Abs(p-tt.p) > 1e-6 {
+			t.Errorf("mannWhitneyU(%v, %v) = %v, %.6f, want %v, %.6f", tt.a, tt.b, u, p, tt.u, tt.p)
+		}
+	}
+}
+
+func TestKeyValue(t *testing.T) {
+	for _, tt := range []struct {
+		v, want string
+	}{
+		{"", ""},
+		{"0", ""},
+		{"0.0", ""},
+		{"1e-05", "1e-05"},
+		{"0.00001", "1e-05"},
+		{"50000000", "5e+07"},
+		{"5e+07", "5e+07"},
+		{"kemtls", "kemtls"},
+		{"Ed25519/ECDSAWithP256AndSHA256", "Ed25519/ECDSAWithP256AndSHA256"},
+	} {
+		if got := keyValue(tt.v); got != tt.want {
+			t.Errorf("keyValue(%q) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestReadRecordsFormats(t *testing.T) {
+	csv := "protocol,delay_ns,loss_rate,success,client_FullProtocol_ns\n" +
+		"kemtls,0,1e-05,true,1000\n" +
+		"kemtls,0,1e-05,true,2000\n" +
+		"kemtls,0,0,true,3000\n" +
+		"kemtls,0,0,false,4000\n"
+	jsonl := `{"protocol":"kemtls","delay_ns":0,"loss_rate":0.00001,"success":true,"client_FullProtocol_ns":1000}` + "\n" +
+		`{"protocol":"kemtls","delay_ns":0,"loss_rate":0.00001,"success":true,"client_FullProtocol_ns":2000}` + "\n" +
+		`{"protocol":"kemtls","delay_ns":0,"loss_rate":0,"success":true,"client_FullProtocol_ns":3000}` + "\n" +
+		`{"protocol":"kemtls","delay_ns":0,"loss_rate":0,"success":false,"client_FullProtocol_ns":4000}` + "\n"
+
+	want := &RecordSet{
+		Scenarios: []string{"protocol=kemtls loss_rate=1e-05", "protocol=kemtls"},
+		Samples: map[string]map[string][]time.Duration{
+			"protocol=kemtls loss_rate=1e-05": {"client_FullProtocol_ns": {1000, 2000}},
+			"protocol=kemtls":                 {"client_FullProtocol_ns": {3000}},
+		},
+	}
+	for name, in := range map[string]string{"csv": csv, "jsonl": jsonl} {
+		rs, err := ReadRecords(strings.NewReader(in))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(rs, want) {
+			t.Errorf("%s: read %+v, want %+v", name, rs, want)
+		}
+	}
+}
@@ -0,0 +1,430 @@
+// Package measure builds the TLS 1.3, PQTLS and KEMTLS configurations used in
+// the local measurements, drives the handshakes and prints their timings.
+package measure
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// In the absence of an application profile standard specifying otherwise,
+	// the maximum validity period is set to 7 days.
+	testDcMaxTTLSeconds = 60 * 60 * 24 * 7
+	testDcMaxTTL        = time.Duration(testDcMaxTTLSeconds * time.Second)
+)
+
+// Protocol is the handshake family being measured.
+type Protocol int
+
+const (
+	TLS13 Protocol = iota
+	PQTLS
+	KEMTLS
+	// KEMTLSPDK is KEMTLS with the server's certificate pre-distributed to
+	// the client.
+	KEMTLSPDK
+)
+
+var protocolNames = []string{
+	TLS13:     "tls13",
+	PQTLS:     "pqtls",
+	KEMTLS:    "kemtls",
+	KEMTLSPDK: "kemtls-pdk",
+}
+
+func (p Protocol) String() string {
+	if int(p) < len(protocolNames) {
+		return protocolNames[p]
+	}
+	return fmt.Sprintf("Protocol(%d)", int(p))
+}
+
+// ParseProtocol returns the protocol family with the given name.
+func ParseProtocol(name string) (Protocol, error) {
+	for p, n := range protocolNames {
+		if n == name {
+			return Protocol(p), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown protocol %q, want one of %s", name, strings.Join(protocolNames, ", "))
+}
+
+// AuthMode selects whether only the server or both peers authenticate.
+type AuthMode int
+
+const (
+	ServerAuth AuthMode = iota
+	MutualAuth
+)
+
+var authNames = []string{
+	ServerAuth: "server-only",
+	MutualAuth: "mutual",
+}
+
+func (a AuthMode) String() string {
+	if int(a) < len(authNames) {
+		return authNames[a]
+	}
+	return fmt.Sprintf("AuthMode(%d)", int(a))
+}
+
+// ParseAuthMode returns the authentication mode with the given name.
+func ParseAuthMode(name string) (AuthMode, error) {
+	for a, n := range authNames {
+		if n == name {
+			return AuthMode(a), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown auth mode %q, want one of %s", name, strings.Join(authNames, ", "))
+}
+
+// Scenario describes a single handshake configuration to measure.
+type Scenario struct {
+	Protocol Protocol
+	Auth     AuthMode
+
+	// ServerGroups and ClientGroups are the CurvePreferences of each peer.
+	// A nil list keeps the crypto/tls default.
+	ServerGroups []tls.CurveID
+	ClientGroups []tls.CurveID
+
+	// ServerScheme is the scheme of the server's delegated credential and
+	// ClientScheme the one of the client's, which is only used for mutual
+	// authentication. A zero scheme means no delegated credential is issued.
+	ServerScheme tls.SignatureScheme
+	ClientScheme tls.SignatureScheme
+
+	// Link is the network emulated between the peers.
+	Link Link
+
+	// CertDir is the directory the certificates are loaded from, see
+	// LoadCerts. If empty, certificates shaped by Chain are generated for
+	// the process.
+	CertDir string
+	Chain   Chain
+
+	// Workload is the application data exchanged after the handshake.
+	Workload Workload
+
+	// Memory measures the allocations of each peer, see MemStats. The peers
+	// then take turns instead of running concurrently, which slows the
+	// handshake down: the timings of such a scenario are not representative.
+	Memory bool
+
+	// Resumption makes every measured handshake resume the session of the
+	// previous one instead of running a full handshake.
+	Resumption Resumption
+}
+
+// DefaultScenario returns the algorithms historically measured for each
+// protocol family and authentication mode.
+func DefaultScenario(p Protocol, a AuthMode) Scenario {
+	s := Scenario{Protocol: p, Auth: a}
+
+	switch {
+	case p == TLS13 && a == ServerAuth:
+		s.ServerScheme = tls.Ed448
+	case p == TLS13 && a == MutualAuth:
+		s.ServerGroups = []tls.CurveID{tls.X25519}
+		s.ClientGroups = []tls.CurveID{tls.X25519}
+		s.ClientScheme = tls.Ed25519
+	case p == PQTLS && a == ServerAuth:
+		s.ClientGroups = []tls.CurveID{tls.Kyber512, tls.X25519}
+		s.ServerScheme = tls.PQTLSWithDilithium3
+	case p == PQTLS && a == MutualAuth:
+		s.ServerGroups = []tls.CurveID{tls.SIKEp434, tls.Kyber512, tls.X25519}
+		s.ClientGroups = []tls.CurveID{tls.SIKEp434, tls.X25519}
+		s.ServerScheme = tls.PQTLSWithDilithium3
+		s.ClientScheme = tls.PQTLSWithDilithium3
+	case a == ServerAuth: // KEMTLS and KEMTLSPDK
+		s.ServerScheme = tls.KEMTLSWithKyber512
+	default:
+		s.ServerGroups = []tls.CurveID{tls.SIKEp434, tls.Kyber512}
+		s.ClientGroups = []tls.CurveID{tls.SIKEp434, tls.Kyber512}
+		s.ServerScheme = tls.KEMTLSWithSIKEp434
+		s.ClientScheme = tls.KEMTLSWithSIKEp434
+	}
+
+	return s
+}
+
+func (s Scenario) String() string {
+	groups := s.ClientGroups
+	if groups == nil {
+		groups = s.ServerGroups
+	}
+	kems := curveList(groups, ",")
+	if kems == "" {
+		kems = "default"
+	}
+
+	str := fmt.Sprintf("%v (kex: %s", s.Protocol, kems)
+	if s.ServerScheme != 0 {
+		str += ", server sig: " + SchemeName(s.ServerScheme)
+	}
+	if s.Auth == MutualAuth && s.ClientScheme != 0 {
+		str += ", client sig: " + SchemeName(s.ClientScheme)
+	}
+	str += ") " + s.Auth.String()
+	if !s.Chain.isZero() {
+		str += " with chain " + s.Chain.String()
+	}
+	if !s.Link.isZero() {
+		str += " over " + s.Link.String()
+	}
+	if !s.Workload.isZero() {
+		str += " exchanging " + s.Workload.String()
+	}
+	if s.Resumption != NoResumption {
+		str += " resuming with " + s.Resumption.String()
+	}
+	return str
+}
+
+// Validate reports whether the algorithms of s can be used by its protocol
+// family: TLS 1.3 is limited to classical groups and signatures, PQTLS needs
+// post-quantum signatures and KEMTLS KEM-based credentials.
+func (s Scenario) Validate() error {
+	if s.CertDir != "" && s.Chain.Schemes != nil {
+		return errors.New("the chain is either loaded from a directory or generated, not both")
+	}
+	if _, err := ParseWorkloadMode(s.Workload.Mode); err != nil {
+		return err
+	}
+	if s.Workload.Size < 0 || s.Workload.RoundTrips < 0 {
+		return errors.New("the workload size and round trips cannot be negative")
+	}
+	if err := CheckResumption(s.Resumption); err != nil {
+		return err
+	}
+
+	want := classicalSignature
+	switch s.Protocol {
+	case PQTLS:
+		want = pqSignature
+	case KEMTLS, KEMTLSPDK:
+		want = kemAuthentication
+	}
+
+	schemes := []tls.SignatureScheme{s.ServerScheme}
+	if s.Auth == MutualAuth {
+		schemes = append(schemes, s.ClientScheme)
+	}
+	for _, scheme := range schemes {
+		if kind, ok := kindOf(scheme); scheme != 0 && ok && kind != want {
+			return fmt.Errorf("%s cannot be used for %v authentication", SchemeName(scheme), s.Protocol)
+		}
+	}
+
+	if s.Protocol == TLS13 {
+		for _, groups := range [][]tls.CurveID{s.ClientGroups, s.ServerGroups} {
+			for _, g := range groups {
+				if isPostQuantumCurve(g) {
+					return fmt.Errorf("%s cannot be used with %v", CurveName(g), s.Protocol)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s Scenario) baseConfig(groups []tls.CurveID) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:       tls.VersionTLS10,
+		MaxVersion:       tls.VersionTLS13,
+		CurvePreferences: groups,
+	}
+
+	switch s.Protocol {
+	case PQTLS:
+		cfg.PQTLSEnabled = true
+	case KEMTLS, KEMTLSPDK:
+		cfg.KEMTLSEnabled = true
+	}
+
+	return cfg
+}
+
+// NewServerConfig returns the server side configuration for s.
+func NewServerConfig(s Scenario) (*tls.Config, error) {
+	certs, err := s.certs()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := s.baseConfig(s.ServerGroups)
+	if s.Auth == MutualAuth {
+		cfg.SupportDelegatedCredential = true // for client auth, the server supports delegated credentials
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		cfg.ClientCAs = certs.roots()
+	}
+
+	cfg.Certificates = []tls.Certificate{s.certificate(certs)}
+	if s.ServerScheme != 0 {
+		if err := addDelegatedCredential(&cfg.Certificates[0], s.ServerScheme, false); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg.KeyLogWriter = keyLogWriter("SSLKEYSERVERLOGFILE")
+
+	return cfg, nil
+}
+
+// NewClientConfig returns the client side configuration for s.
+func NewClientConfig(s Scenario) (*tls.Config, error) {
+	certs, err := s.certs()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := s.baseConfig(s.ClientGroups)
+	cfg.SupportDelegatedCredential = true
+	cfg.ServerName = serverName(certs.Leaf.Leaf)
+	cfg.RootCAs = certs.roots()
+
+	if s.Auth == MutualAuth {
+		cfg.Certificates = []tls.Certificate{s.certificate(certs)}
+		if s.ClientScheme != 0 {
+			if err := addDelegatedCredential(&cfg.Certificates[0], s.ClientScheme, true); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	cfg.KeyLogWriter = keyLogWriter("SSLKEYCLIENTLOGFILE")
+	if cfg.KeyLogWriter == nil {
+		cfg.KeyLogWriter = keyLogWriter("SSLKEYLOGFILE")
+	}
+
+	return cfg, nil
+}
+
+// serverName returns the name the client expects leaf to be valid for: its
+// first DNS name or, failing that, its first IP address.
+func serverName(leaf *x509.Certificate) string {
+	if len(leaf.DNSNames) > 0 {
+		return leaf.DNSNames[0]
+	}
+	if len(leaf.IPAddresses) > 0 {
+		return leaf.IPAddresses[0].String()
+	}
+	return ""
+}
+
+// chainVerifier validates a peer's certificate chain like crypto/tls does.
+// crypto/tls cannot time its own verification, so the chain is validated
+// again after the handshake to report the time it takes.
+type chainVerifier struct {
+	roots   *x509.CertPool
+	dnsName string // empty for client certificates
+	usage   x509.ExtKeyUsage
+}
+
+// clientVerifier and serverVerifier return the checks crypto/tls runs on the
+// chain the client and the server receive with config.
+func clientVerifier(config *tls.Config) chainVerifier {
+	return chainVerifier{roots: config.RootCAs, dnsName: config.ServerName, usage: x509.ExtKeyUsageServerAuth}
+}
+
+func serverVerifier(config *tls.Config) chainVerifier {
+	return chainVerifier{roots: config.ClientCAs, usage: x509.ExtKeyUsageClientAuth}
+}
+
+// time returns how long validating the chain of certs, from parsing to
+// the root, takes.
+func (v chainVerifier) time(certs []*x509.Certificate) (time.Duration, error) {
+	rawCerts := make([][]byte, len(certs))
+	for i, cert := range certs {
+		rawCerts[i] = cert.Raw
+	}
+	start := time.Now()
+	err := v.verify(rawCerts)
+	return time.Since(start), err
+}
+
+func (v chainVerifier) verify(rawCerts [][]byte) error {
+	if len(rawCerts) == 0 {
+		return errors.New("no certificate to verify")
+	}
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("parsing certificate %d: %v", i, err)
+		}
+		certs[i] = cert
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         v.roots,
+		DNSName:       v.dnsName,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{v.usage},
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(opts)
+	return err
+}
+
+// addDelegatedCredential issues a delegated credential of the given scheme
+// from cert and attaches it to cert.
+func addDelegatedCredential(cert *tls.Certificate, scheme tls.SignatureScheme, isClient bool) error {
+	maxTTL, _ := time.ParseDuration("24h")
+	validTime := maxTTL + time.Now().Sub(cert.Leaf.NotBefore)
+	dc, priv, err := tls.NewDelegatedCredential(cert, scheme, validTime, isClient)
+	if err != nil {
+		return fmt.Errorf("creating %s delegated credential: %v", SchemeName(scheme), err)
+	}
+
+	cert.DelegatedCredentials = []tls.DelegatedCredentialPair{{DC: dc, PrivateKey: priv}}
+	return nil
+}
+
+// keyLogs holds the key log files opened so far by name. Every config built
+// in a run shares them, and they stay open until the process exits.
+var keyLogs struct {
+	sync.Mutex
+	files map[string]io.Writer
+}
+
+// keyLogWriter opens the key log file named by the environment variable env,
+// if set, so that the handshakes can be decrypted in Wireshark.
+func keyLogWriter(env string) io.Writer {
+	tlsKeyLogFile := os.Getenv(env)
+	if tlsKeyLogFile == "" {
+		return nil
+	}
+
+	keyLogs.Lock()
+	defer keyLogs.Unlock()
+	if kw, ok := keyLogs.files[tlsKeyLogFile]; ok {
+		return kw
+	}
+	if keyLogs.files == nil {
+		keyLogs.files = make(map[string]io.Writer)
+	}
+
+	kw, err := os.OpenFile(tlsKeyLogFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		log.Printf("Cannot open key log file: %s\n", err)
+		keyLogs.files[tlsKeyLogFile] = nil
+		return nil
+	}
+	keyLogs.files[tlsKeyLogFile] = kw
+	return kw
+}
@@ -0,0 +1,89 @@
+package measure
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"text/tabwriter"
+	"time"
+)
+
+// CPUTime is the CPU time one peer spent on its handshake, on the thread
+// running it, and the wall-clock time the handshake took on that side.
+// Comparing them tells computation from waiting for the peer or for the
+// scheduler. CPU time is only measured on Linux.
+type CPUTime struct {
+	User   time.Duration
+	System time.Duration
+	Wall   time.Duration
+}
+
+// Total returns the user and system time.
+func (c CPUTime) Total() time.Duration {
+	return c.User + c.System
+}
+
+// Ratio returns the fraction of the wall-clock time spent on the CPU.
+func (c CPUTime) Ratio() float64 {
+	if c.Wall == 0 {
+		return 0
+	}
+	return float64(c.Total()) / float64(c.Wall)
+}
+
+// CPUUsage holds the CPUTime of each peer.
+type CPUUsage struct {
+	Client CPUTime
+	Server CPUTime
+}
+
+// measureCPU runs f locked to the calling thread and returns the CPU and
+// wall-clock time it took.
+func measureCPU(f func()) CPUTime {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	startUser, startSystem, ok := threadCPUTime()
+	start := time.Now()
+	f()
+	c := CPUTime{Wall: time.Since(start)}
+	if endUser, endSystem, endOK := threadCPUTime(); ok && endOK {
+		c.User = endUser - startUser
+		c.System = endSystem - startSystem
+	}
+	return c
+}
+
+// PrintCPU writes the mean CPU and wall-clock time each peer spent on its
+// handshake in results, and their ratio, to w. A ratio close to 1 means the
+// side was computing; a low one that it was waiting.
+func PrintCPU(w io.Writer, results []Result) {
+	if len(results) == 0 {
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Side\tUser\tSystem\tCPU\tWall\tCPU/Wall\t")
+	for _, side := range []struct {
+		name string
+		get  func(Result) CPUTime
+	}{
+		{ClientSide, func(res Result) CPUTime { return res.CPU.Client }},
+		{ServerSide, func(res Result) CPUTime { return res.CPU.Server }},
+	} {
+		var mean CPUTime
+		for _, res := range results {
+			c := side.get(res)
+			mean.User += c.User
+			mean.System += c.System
+			mean.Wall += c.Wall
+		}
+		n := time.Duration(len(results))
+		mean.User /= n
+		mean.System /= n
+		mean.Wall /= n
+		fmt.Fprintf(tw, "%s\t%v\t%v\t%v\t%v\t%.2f\t\n",
+			side.name, mean.User, mean.System, mean.Total(), mean.Wall, mean.Ratio())
+	}
+	tw.Flush()
+}
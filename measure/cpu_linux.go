@@ -0,0 +1,19 @@
+package measure
+
+import (
+	"syscall"
+	"time"
+)
+
+// rusageThread is RUSAGE_THREAD, which syscall does not define.
+const rusageThread = 1
+
+// threadCPUTime returns the user and system time the calling thread has
+// used so far. The caller must be locked to its thread.
+func threadCPUTime() (user, system time.Duration, ok bool) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(rusageThread, &ru); err != nil {
+		return 0, 0, false
+	}
+	return time.Duration(ru.Utime.Nano()), time.Duration(ru.Stime.Nano()), true
+}
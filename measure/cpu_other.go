@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package measure
+
+import "time"
+
+// threadCPUTime is only implemented on Linux, which can report the time
+// used by a single thread.
+func threadCPUTime() (user, system time.Duration, ok bool) {
+	return 0, 0, false
+}
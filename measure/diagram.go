@@ -0,0 +1,228 @@
+package measure
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"text/tabwriter"
+)
+
+// Diagram formats.
+const (
+	DiagramMermaid  = "mermaid"
+	DiagramPlantUML = "plantuml"
+	DiagramSVG      = "svg"
+)
+
+// stepMessages names the handshake message each step sends to the peer.
+var stepMessages = map[string]string{
+	"WriteClientHello":         "ClientHello",
+	"WriteServerHello":         "ServerHello",
+	"WriteEncryptedExtensions": "EncryptedExtensions",
+	"WriteCertificate":         "Certificate",
+	"WriteCertificateVerify":   "CertificateVerify",
+	"WriteKEMCiphertext":       "KEMCiphertext",
+	"WriteClientFinished":      "Finished",
+	"WriteServerFinished":      "Finished",
+}
+
+// DiagramStep is a step of a sequence diagram: a message Side sends to the
+// other peer, or work Side does on its own.
+type DiagramStep struct {
+	TimelineEntry
+	// Message is the handshake message sent, empty for local work, and Size
+	// its size on the wire, zero if it was not recorded.
+	Message string
+	Size    int
+	// Untimed is set for messages no timing event covers, whose At and Took
+	// are zero.
+	Untimed bool
+}
+
+// Diagram returns the steps of the handshake of res, in the order they
+// happened on the timeline of its events.
+//
+// The timing events have a single WriteClientHello step, so a
+// HelloRetryRequest and the second ClientHello it asks for follow the first
+// ClientHello as untimed messages.
+func Diagram(res Result) []DiagramStep {
+	var steps []DiagramStep
+	for _, e := range Timeline(res.Events) {
+		d := DiagramStep{TimelineEntry: e, Message: stepMessages[e.Step]}
+		if d.Message != "" {
+			f := res.Wire.Client
+			if e.Side == ServerSide {
+				f = res.Wire.Server
+			}
+			d.Size = f.MessageSize(d.Message)
+		}
+		steps = append(steps, d)
+
+		if e.Step == "WriteClientHello" && res.Wire.Client.MessageCount(secondClientHello) > 0 {
+			steps = append(steps,
+				DiagramStep{
+					TimelineEntry: TimelineEntry{Side: ServerSide},
+					Message:       "HelloRetryRequest",
+					Size:          res.Wire.Server.MessageSize("HelloRetryRequest"),
+					Untimed:       true,
+				},
+				DiagramStep{
+					TimelineEntry: TimelineEntry{Side: ClientSide},
+					Message:       secondClientHello,
+					Size:          res.Wire.Client.MessageSize(secondClientHello),
+					Untimed:       true,
+				})
+		}
+	}
+	return steps
+}
+
+// label describes the step, e.g. "ClientHello (290 B)" or
+// "ProcessServerHello".
+func (d DiagramStep) label() string {
+	switch {
+	case d.Message != "" && d.Size > 0:
+		return fmt.Sprintf("%s (%d B)", d.Message, d.Size)
+	case d.Message != "":
+		return d.Message
+	}
+	return d.Step
+}
+
+// timing is the annotation of the step: when it ended and how long it took,
+// after prefix, or nothing for an untimed step.
+func (d DiagramStep) timing(prefix string) string {
+	if d.Untimed {
+		return ""
+	}
+	return fmt.Sprintf("%s%v (+%v)", prefix, d.At, d.Took)
+}
+
+// WriteDiagram writes steps to w as a sequence diagram in format.
+func WriteDiagram(w io.Writer, format string, steps []DiagramStep) error {
+	switch format {
+	case DiagramMermaid:
+		writeMermaid(w, steps)
+	case DiagramPlantUML:
+		writePlantUML(w, steps)
+	case DiagramSVG:
+		writeSVG(w, steps)
+	default:
+		return fmt.Errorf("unknown diagram format %q, want %s, %s or %s", format, DiagramMermaid, DiagramPlantUML, DiagramSVG)
+	}
+	return nil
+}
+
+func writeMermaid(w io.Writer, steps []DiagramStep) {
+	fmt.Fprintln(w, "sequenceDiagram")
+	fmt.Fprintln(w, "    participant client as Client")
+	fmt.Fprintln(w, "    participant server as Server")
+	for _, d := range steps {
+		if d.Message != "" {
+			fmt.Fprintf(w, "    %s->>%s: %s%s\n", d.Side, peer(d.Side), d.label(), d.timing(" at "))
+			continue
+		}
+		side := "left of"
+		if d.Side == ServerSide {
+			side = "right of"
+		}
+		fmt.Fprintf(w, "    Note %s %s: %s%s\n", side, d.Side, d.label(), d.timing(" at "))
+	}
+}
+
+func writePlantUML(w io.Writer, steps []DiagramStep) {
+	fmt.Fprintln(w, "@startuml")
+	fmt.Fprintln(w, "participant Client as client")
+	fmt.Fprintln(w, "participant Server as server")
+	for _, d := range steps {
+		if d.Message != "" {
+			fmt.Fprintf(w, "%s -> %s: %s%s\n", d.Side, peer(d.Side), d.label(), d.timing("\\nat "))
+			continue
+		}
+		side := "left of"
+		if d.Side == ServerSide {
+			side = "right of"
+		}
+		fmt.Fprintf(w, "note %s %s: %s%s\n", side, d.Side, d.label(), d.timing("\\nat "))
+	}
+	fmt.Fprintln(w, "@enduml")
+}
+
+// The layout of the SVG diagrams, in pixels.
+const (
+	svgWidth   = 720
+	svgClientX = 240
+	svgServerX = 480
+	svgTop     = 60
+	svgRow     = 36
+)
+
+func writeSVG(w io.Writer, steps []DiagramStep) {
+	height := svgTop + svgRow*(len(steps)+1)
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="12">`+"\n", svgWidth, height)
+	fmt.Fprintln(w, `<defs><marker id="arrow" markerWidth="10" markerHeight="10" refX="9" refY="3" orient="auto"><path d="M0,0 L9,3 L0,6 z"/></marker></defs>`)
+	for _, p := range []struct {
+		name string
+		x    int
+	}{{"Client", svgClientX}, {"Server", svgServerX}} {
+		fmt.Fprintf(w, `<rect x="%d" y="10" width="80" height="26" fill="#eee" stroke="black"/>`+"\n", p.x-40)
+		fmt.Fprintf(w, `<text x="%d" y="28" text-anchor="middle" font-weight="bold">%s</text>`+"\n", p.x, p.name)
+		fmt.Fprintf(w, `<line x1="%d" y1="36" x2="%d" y2="%d" stroke="gray" stroke-dasharray="4"/>`+"\n", p.x, p.x, height-10)
+	}
+
+	for i, d := range steps {
+		y := svgTop + svgRow*i + svgRow/2
+		from, to := svgClientX, svgServerX
+		if d.Side == ServerSide {
+			from, to = to, from
+		}
+		if d.Message != "" {
+			fmt.Fprintf(w, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black" marker-end="url(#arrow)"/>`+"\n", from, y, to, y)
+			fmt.Fprintf(w, `<text x="%d" y="%d" text-anchor="middle">%s</text>`+"\n", (from+to)/2, y-4, html.EscapeString(d.label()))
+			fmt.Fprintf(w, `<text x="%d" y="%d" text-anchor="middle" fill="gray">%s</text>`+"\n", (from+to)/2, y+12, html.EscapeString(d.timing("")))
+			continue
+		}
+		// Local work is written outside the lifelines, next to its side.
+		x, anchor := from-8, "end"
+		if d.Side == ServerSide {
+			x, anchor = from+8, "start"
+		}
+		fmt.Fprintf(w, `<text x="%d" y="%d" text-anchor="%s">%s</text>`+"\n", x, y, anchor, html.EscapeString(d.label()))
+		fmt.Fprintf(w, `<text x="%d" y="%d" text-anchor="%s" fill="gray">%s</text>`+"\n", x, y+14, anchor, html.EscapeString(d.timing("")))
+	}
+	fmt.Fprintln(w, "</svg>")
+}
+
+// peer returns the other side.
+func peer(side string) string {
+	if side == ClientSide {
+		return ServerSide
+	}
+	return ClientSide
+}
+
+// writeLadder writes steps to w as text, the client on the left and the
+// server on the right.
+func writeLadder(w io.Writer, steps []DiagramStep) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Client\t\tServer\tAt\tTook")
+	for _, d := range steps {
+		arrow := ""
+		switch {
+		case d.Message != "" && d.Side == ClientSide:
+			arrow = "-->"
+		case d.Message != "":
+			arrow = "<--"
+		}
+		client, server := d.label(), ""
+		if d.Side == ServerSide {
+			client, server = server, client
+		}
+		at, took := fmt.Sprint(d.At), fmt.Sprintf("+%v", d.Took)
+		if d.Untimed {
+			at, took = "", ""
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", client, arrow, server, at, took)
+	}
+	tw.Flush()
+}
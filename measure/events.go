@@ -0,0 +1,114 @@
+package measure
+
+import (
+	"crypto/tls"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Event is a CFEvent raised by one of the peers.
+type Event struct {
+	Side string
+	// At is when the event was received, since the collector was created,
+	// on the monotonic clock.
+	At    time.Duration
+	Event tls.CFEvent
+}
+
+// EventCollector records the CFEvents of both peers of a connection, in the
+// order they are raised. It is safe for concurrent use.
+type EventCollector struct {
+	start time.Time
+
+	mu     sync.Mutex
+	events []Event
+}
+
+// NewEventCollector returns a collector whose timestamps start now.
+func NewEventCollector() *EventCollector {
+	return &EventCollector{start: time.Now()}
+}
+
+// Handler returns a CFEventHandler recording the events of side.
+func (c *EventCollector) Handler(side string) func(tls.CFEvent) {
+	return func(event tls.CFEvent) {
+		at := time.Since(c.start)
+		c.mu.Lock()
+		c.events = append(c.events, Event{Side: side, At: at, Event: event})
+		c.mu.Unlock()
+	}
+}
+
+// Events returns a copy of the events recorded so far.
+func (c *EventCollector) Events() []Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Event(nil), c.events...)
+}
+
+// timingInfo returns the last timing event of each peer in events.
+func timingInfo(events []Event) TimingInfo {
+	var ti TimingInfo
+	for _, e := range events {
+		switch te := e.Event.(type) {
+		case tls.CFEventTLS13ServerHandshakeTimingInfo:
+			ti.ServerTimingInfo = te
+		case tls.CFEventTLS13ClientHandshakeTimingInfo:
+			ti.ClientTimingInfo = te
+		}
+	}
+	return ti
+}
+
+// TimelineEntry is the end of a step of the handshake on a timeline shared
+// by both peers. Took is the time since the previous step of the side ended,
+// or since the side started for its first step.
+type TimelineEntry struct {
+	Side string
+	Step string
+	At   time.Duration
+	Took time.Duration
+}
+
+// Timeline places the steps of the timing events in events on a single
+// timeline, starting when the collector was created, sorted by time. The
+// steps are relative to the start of each side's handshake; the timing event
+// is raised when it ends, so the side started FullProtocol before it was
+// received.
+func Timeline(events []Event) []TimelineEntry {
+	var timeline []TimelineEntry
+	starts := map[string]time.Duration{}
+	for _, e := range events {
+		var res Result
+		var side string
+		switch te := e.Event.(type) {
+		case tls.CFEventTLS13ServerHandshakeTimingInfo:
+			res.Timing.ServerTimingInfo = te
+			side = ServerSide
+		case tls.CFEventTLS13ClientHandshakeTimingInfo:
+			res.Timing.ClientTimingInfo = te
+			side = ClientSide
+		default:
+			continue
+		}
+
+		full, _ := LookupStep(side, "FullProtocol")
+		start := e.At - full.Duration(res)
+		starts[side] = start
+		for _, st := range timingSteps {
+			if st.Side != side || st.Duration(res) == 0 {
+				continue
+			}
+			timeline = append(timeline, TimelineEntry{Side: side, Step: st.Name, At: start + st.Duration(res)})
+		}
+		timeline = append(timeline, TimelineEntry{Side: side, Step: full.Name, At: e.At})
+	}
+	sort.SliceStable(timeline, func(i, j int) bool { return timeline[i].At < timeline[j].At })
+
+	for i, e := range timeline {
+		timeline[i].Took = e.At - starts[e.Side]
+		starts[e.Side] = e.At
+	}
+	return timeline
+}
@@ -0,0 +1,218 @@
+package measure
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Export formats.
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// field is a named value of an exported record. Key fields describe the
+// scenario rather than what was measured.
+type field struct {
+	name  string
+	value interface{}
+	key   bool
+}
+
+// Exporter writes one record per handshake in CSV or JSON Lines. Both formats
+// share the same flat schema, see Columns.
+type Exporter struct {
+	format string
+	w      *bufio.Writer
+	csv    *csv.Writer
+
+	wroteHeader bool
+}
+
+// NewExporter returns an Exporter writing records in format to w.
+func NewExporter(w io.Writer, format string) (*Exporter, error) {
+	e := &Exporter{format: format, w: bufio.NewWriter(w)}
+	switch format {
+	case FormatCSV:
+		e.csv = csv.NewWriter(e.w)
+	case FormatJSONL:
+	default:
+		return nil, fmt.Errorf("unknown export format %q, want %s or %s", format, FormatCSV, FormatJSONL)
+	}
+	return e, nil
+}
+
+// Columns returns the names of the exported fields, in order. Durations are
+// integer nanoseconds in columns named <side>_<step>_ns, and lists of
+// algorithms are joined with ";".
+func Columns() []string {
+	fields := record(Scenario{}, 0, Result{})
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.name
+	}
+	return names
+}
+
+// record returns the fields of a record. Columns are only ever appended, in
+// the order the measurements were introduced, so that readers of older
+// exports can keep finding them by position.
+func record(s Scenario, iteration int, res Result) []field {
+	key := func(name string, value interface{}) field { return field{name, value, true} }
+	step := func(side, name string) field {
+		st, _ := LookupStep(side, name)
+		return field{side + "_" + name + "_ns", st.Duration(res).Nanoseconds(), false}
+	}
+
+	fields := []field{
+		key("protocol", s.Protocol.String()),
+		key("auth", s.Auth.String()),
+		key("client_groups", curveList(s.ClientGroups, ";")),
+		key("server_groups", curveList(s.ServerGroups, ";")),
+		key("server_scheme", schemeField(s.ServerScheme)),
+		key("client_scheme", schemeField(s.ClientScheme)),
+		{"iteration", iteration, false},
+		{"success", s.Succeeded(res), false},
+		{"dc_used", res.DCUsed, false},
+		{"kemtls_used", res.KEMTLSUsed, false},
+		{"pqtls_used", res.PQTLSUsed, false},
+	}
+	for _, st := range timingSteps {
+		fields = append(fields, step(st.Side, st.Name))
+	}
+	fields = append(fields, step(ClientSide, "FullProtocol"), step(ServerSide, "FullProtocol"))
+
+	for _, side := range []struct {
+		name string
+		f    FlightStats
+	}{{ClientSide, res.Wire.Client}, {ServerSide, res.Wire.Server}} {
+		fields = append(fields,
+			field{side.name + "_bytes", side.f.Bytes, false},
+			field{side.name + "_records", side.f.Records, false})
+		for _, m := range WireMessages {
+			fields = append(fields, field{side.name + "_" + m + "_bytes", side.f.MessageSize(m), false})
+		}
+	}
+
+	fields = append(fields,
+		key("delay_ns", s.Link.Delay.Nanoseconds()),
+		key("jitter_ns", s.Link.Jitter.Nanoseconds()),
+		key("bandwidth_bps", s.Link.Bandwidth),
+		key("initcwnd", s.Link.InitCwnd),
+		step(ClientSide, "HandshakeLatency"),
+		step(ClientSide, "TimeToFirstByte"))
+
+	fields = append(fields,
+		key("loss_rate", s.Link.Loss.Rate()),
+		key("loss_burst", s.Link.Loss.Burst()),
+		key("rto_ns", s.Link.RTO.Nanoseconds()))
+
+	fields = append(fields, step(ClientSide, "VerifyChain"), step(ServerSide, "VerifyChain"))
+
+	fields = append(fields, key("chain", s.Chain.String()))
+
+	fields = append(fields, step(ClientSide, "CPUTime"), step(ServerSide, "CPUTime"))
+	for _, side := range []struct {
+		name string
+		cpu  CPUTime
+	}{{ClientSide, res.CPU.Client}, {ServerSide, res.CPU.Server}} {
+		fields = append(fields,
+			field{side.name + "_cpu_user_ns", side.cpu.User.Nanoseconds(), false},
+			field{side.name + "_cpu_system_ns", side.cpu.System.Nanoseconds(), false},
+			field{side.name + "_cpu_wall_ns", side.cpu.Wall.Nanoseconds(), false},
+			field{side.name + "_cpu_ratio", side.cpu.Ratio(), false})
+	}
+
+	for _, side := range []struct {
+		name string
+		mem  MemStats
+	}{{ClientSide, res.Memory.Client}, {ServerSide, res.Memory.Server}} {
+		fields = append(fields,
+			field{side.name + "_alloc_bytes", side.mem.Bytes, false},
+			field{side.name + "_allocs", side.mem.Allocs, false},
+			field{side.name + "_peak_heap_bytes", side.mem.PeakHeap, false})
+	}
+
+	fields = append(fields,
+		key("workload", s.Workload.mode()),
+		key("app_size", s.Workload.size()),
+		key("round_trips", s.Workload.roundTrips()),
+		step(ServerSide, "TimeToFirstByte"),
+		step(ClientSide, "TimeToLastByte"),
+		step(ServerSide, "TimeToLastByte"))
+	for _, side := range []struct {
+		name string
+		app  AppStats
+	}{{ClientSide, res.App.Client}, {ServerSide, res.App.Server}} {
+		fields = append(fields,
+			field{side.name + "_app_bytes", side.app.Bytes, false},
+			field{side.name + "_goodput_bps", side.app.Goodput(), false})
+	}
+
+	fields = append(fields, step(ClientSide, "TimeToFirstWrite"), step(ClientSide, "FirstWriteAfterServerFinished"))
+
+	fields = append(fields, key("resumption", resumptionField(s.Resumption)))
+
+	fields = append(fields, field{ClientSide + "_" + secondClientHello + "_bytes", res.Wire.Client.MessageSize(secondClientHello), false})
+
+	return fields
+}
+
+func schemeField(scheme tls.SignatureScheme) string {
+	if scheme == 0 {
+		return ""
+	}
+	return SchemeName(scheme)
+}
+
+// Write exports the result of the iteration-th handshake of s.
+func (e *Exporter) Write(s Scenario, iteration int, res Result) error {
+	fields := record(s, iteration, res)
+
+	if e.format == FormatCSV {
+		if !e.wroteHeader {
+			if err := e.csv.Write(Columns()); err != nil {
+				return err
+			}
+			e.wroteHeader = true
+		}
+		row := make([]string, len(fields))
+		for i, f := range fields {
+			row[i] = fmt.Sprint(f.value)
+		}
+		return e.csv.Write(row)
+	}
+
+	// Written by hand to keep the keys in column order.
+	e.w.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			e.w.WriteByte(',')
+		}
+		name, _ := json.Marshal(f.name)
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return err
+		}
+		e.w.Write(name)
+		e.w.WriteByte(':')
+		e.w.Write(value)
+	}
+	_, err := e.w.WriteString("}\n")
+	return err
+}
+
+// Flush writes any buffered records to the underlying writer.
+func (e *Exporter) Flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return e.w.Flush()
+}
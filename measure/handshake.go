@@ -0,0 +1,394 @@
+package measure
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+)
+
+const (
+	serverMsg = "hello, client"
+	clientMsg = "hello, server"
+)
+
+func newLocalListener() net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		ln, err = net.Listen("tcp6", "[::1]:0")
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return ln
+}
+
+// TimingInfo holds the handshake timings reported by each peer.
+type TimingInfo struct {
+	ServerTimingInfo tls.CFEventTLS13ServerHandshakeTimingInfo
+	ClientTimingInfo tls.CFEventTLS13ClientHandshakeTimingInfo
+}
+
+// Latency is the client's wall-clock view of the connection, which includes
+// the time spent on the emulated network.
+type Latency struct {
+	// Handshake is the time from dialing until the handshake completed.
+	Handshake time.Duration
+	// FirstByte is the time from dialing until the server's first
+	// application data was read.
+	FirstByte time.Duration
+	// ClientData is the time from dialing until the client wrote its first
+	// application data record.
+	ClientData time.Duration
+}
+
+// ClientDataAfterServerFinished returns how long after the server wrote its
+// Finished the client wrote its first application data record, negative if
+// the client's data went out first, as KEMTLS allows. It is zero if either
+// time is unknown.
+func (res Result) ClientDataAfterServerFinished() time.Duration {
+	if res.Latency.ClientData == 0 {
+		return 0
+	}
+	// The server's steps are timed from its start, FullProtocol before its
+	// timing event was received; see Timeline.
+	for _, e := range res.Events {
+		te, ok := e.Event.(tls.CFEventTLS13ServerHandshakeTimingInfo)
+		if ok && te.WriteServerFinished != 0 {
+			return res.Latency.ClientData - (e.At - te.FullProtocol + te.WriteServerFinished)
+		}
+	}
+	return 0
+}
+
+// Verification is the time each peer spent validating the other's
+// certificate chain, zero if it received none. crypto/tls validates the
+// chains within the handshake; the times are those of the same checks
+// repeated once the handshake is over.
+type Verification struct {
+	Client time.Duration
+	Server time.Duration
+}
+
+// timeVerification repeats the validation of each chain received in the
+// handshake of s and records the time it takes. Resumed handshakes, and the
+// KEMTLS-PDK client, which has the server's certificate beforehand, receive
+// none.
+func (res *Result) timeVerification(s Scenario, clientConfig, serverConfig *tls.Config) error {
+	if res.ClientState.DidResume {
+		return nil
+	}
+	var err error
+	if s.Protocol != KEMTLSPDK && len(res.ClientState.PeerCertificates) > 0 {
+		res.Verification.Client, err = clientVerifier(clientConfig).time(res.ClientState.PeerCertificates)
+		if err != nil {
+			return fmt.Errorf("validating the server's chain: %v", err)
+		}
+	}
+	if len(res.ServerState.PeerCertificates) > 0 {
+		res.Verification.Server, err = serverVerifier(serverConfig).time(res.ServerState.PeerCertificates)
+		if err != nil {
+			return fmt.Errorf("validating the client's chain: %v", err)
+		}
+	}
+	return nil
+}
+
+// Result is the outcome of a single handshake.
+type Result struct {
+	// Events are the events raised by both peers, timed from dialing, and
+	// Timing the last timing event of each.
+	Events       []Event
+	Timing       TimingInfo
+	Wire         WireStats
+	Latency      Latency
+	Verification Verification
+	CPU          CPUUsage
+	Memory       MemoryUsage
+	App          AppUsage
+
+	// DCUsed reports whether the authenticating peer's delegated credential
+	// was verified: the server's for server-only authentication and the
+	// client's for mutual authentication.
+	DCUsed     bool
+	KEMTLSUsed bool
+	PQTLSUsed  bool
+
+	ClientState tls.ConnectionState
+	ServerState tls.ConnectionState
+}
+
+// TestConnWithDC performs a handshake between clientConfig and serverConfig
+// over a local connection, emulating link on it, and exchanges clientMsg
+// and serverMsg on it.
+// The returned Result reports the DC, KEMTLS and PQTLS usage as seen by
+// both ends; the caller decides which ones it expects.
+func TestConnWithDC(clientMsg, serverMsg string, clientConfig, serverConfig *tls.Config, link Link) (Result, error) {
+	return testConn(clientMsg, serverMsg, clientConfig, serverConfig, Scenario{Link: link})
+}
+
+// testConn is TestConnWithDC over s.Link, running s.Workload after the
+// handshake and, if s.Memory is set, the peers in lockstep to measure the
+// allocations of each.
+func testConn(clientMsg, serverMsg string, clientConfig, serverConfig *tls.Config, s Scenario) (res Result, err error) {
+	clientConfig = clientConfig.Clone()
+	serverConfig = serverConfig.Clone()
+	var clientMem, serverMem *memMeter
+	if s.Memory {
+		ls := newLockstep()
+		clientMem, serverMem = ls.meter(), ls.meter()
+	}
+
+	// The events are timed from dialing, like the Latency.
+	events := NewEventCollector()
+	defer func() {
+		res.Events = events.Events()
+		res.Timing = timingInfo(res.Events)
+	}()
+	clientConfig.CFEventHandler = events.Handler(ClientSide)
+	serverConfig.CFEventHandler = events.Handler(ServerSide)
+
+	start := events.start
+	clientConn, accept, host, err := connect(s.Link)
+	if err != nil {
+		return res, err
+	}
+
+	serverCh := make(chan *tls.Conn, 1)
+	var serverErr error
+	var serverWire FlightStats
+	var serverCPU CPUTime
+	var serverApp AppStats
+	go func() {
+		serverConn, err := accept()
+		if err != nil {
+			serverErr = err
+			serverCh <- nil
+			return
+		}
+		rc := newRecordingConn(serverConn)
+		server := tls.Server(metered(rc, serverMem), serverConfig)
+		serverCPU = measureCPU(func() {
+			serverMem.begin()
+			err = server.Handshake()
+			serverMem.stop()
+		})
+		if err != nil {
+			rc.Close()
+			serverErr = fmt.Errorf("handshake error: %v", err)
+			serverCh <- nil
+			return
+		}
+		serverWire = rc.flight()
+
+		if err := s.Workload.runServer(server, clientMsg, serverMsg, start, &serverApp); err != nil {
+			server.Close()
+			serverErr = err
+			serverCh <- nil
+			return
+		}
+		serverCh <- server
+	}()
+
+	// The server goroutine writes to res, so every return joins it. Closing
+	// the client's end makes a server still waiting on it fail.
+	abort := func(err error) (Result, error) {
+		clientConn.Close()
+		if server := <-serverCh; server != nil {
+			server.Close()
+		}
+		return res, err
+	}
+
+	var client *tls.Conn
+	var rc *recordingConn
+	res.CPU.Client = measureCPU(func() {
+		clientMem.begin()
+		client, rc, err = dial(clientConn, host, clientConfig, clientMem)
+		clientMem.stop()
+	})
+	if err != nil {
+		return abort(err)
+	}
+	defer client.Close()
+	res.Latency.Handshake = time.Since(start)
+	res.Wire.Client = rc.flight()
+	rc.handshakeOver()
+
+	// The client writes as soon as its side of the handshake is done, which
+	// may be before the server's is.
+	if err := s.Workload.runClient(client, clientMsg, serverMsg, start, &res.App.Client); err != nil {
+		return abort(err)
+	}
+	res.Latency.FirstByte = res.App.Client.FirstByte
+	if at := rc.firstDataAt(); !at.IsZero() {
+		res.Latency.ClientData = at.Sub(start)
+	}
+
+	server := <-serverCh
+	if server == nil {
+		return res, serverErr
+	}
+	defer server.Close()
+	res.Wire.Server = serverWire
+	res.CPU.Server = serverCPU
+	res.App.Server = serverApp
+	if s.Memory {
+		res.Memory = MemoryUsage{Client: clientMem.stats, Server: serverMem.stats}
+	}
+
+	res.ClientState = client.ConnectionState()
+	res.ServerState = server.ConnectionState()
+	res.KEMTLSUsed = res.ClientState.DidKEMTLS && res.ServerState.DidKEMTLS
+	res.PQTLSUsed = res.ClientState.DidPQTLS && res.ServerState.DidPQTLS
+
+	return res, nil
+}
+
+// Session holds the configurations built for a scenario so that its
+// handshake can be repeated.
+type Session struct {
+	Scenario Scenario
+
+	clientConfig *tls.Config
+	serverConfig *tls.Config
+}
+
+// NewSession builds the client and server configurations for s. For
+// KEMTLS-PDK it also runs the KEMTLS handshake that gives the client the
+// server's certificate.
+func NewSession(s Scenario) (*Session, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	serverConfig, err := NewServerConfig(s)
+	if err != nil {
+		return nil, err
+	}
+	clientConfig, err := NewClientConfig(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Protocol == KEMTLSPDK {
+		// A full KEMTLS handshake gives the client the server's certificate
+		// to pre-distribute.
+		res, err := TestConnWithDC(clientMsg, serverMsg, clientConfig, serverConfig, s.Link)
+		if err != nil {
+			return nil, fmt.Errorf("kemtls handshake to cache the server certificate: %v", err)
+		}
+		clientConfig.CachedCert = res.ClientState.CertificateMessage
+	}
+
+	if s.Resumption != NoResumption {
+		// A full handshake gives the client the ticket the first measured
+		// handshake resumes; each one then leaves a new ticket for the next.
+		cache := &sessionCache{}
+		clientConfig.ClientSessionCache = cache
+		// Every handshake runs on a clone of serverConfig, which would
+		// otherwise draw its own ticket key.
+		var key [32]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return nil, err
+		}
+		serverConfig.SetSessionTicketKeys([][32]byte{key})
+		if _, err := TestConnWithDC(clientMsg, serverMsg, clientConfig, serverConfig, s.Link); err != nil {
+			return nil, fmt.Errorf("full handshake to get a session ticket: %v", err)
+		}
+		if _, ok := cache.Get(""); !ok {
+			return nil, errors.New("the server sent no session ticket to resume")
+		}
+	}
+
+	return &Session{Scenario: s, clientConfig: clientConfig, serverConfig: serverConfig}, nil
+}
+
+// Handshake measures one handshake of the session's scenario.
+func (ss *Session) Handshake() (Result, error) {
+	res, err := testConn(clientMsg, serverMsg, ss.clientConfig, ss.serverConfig, ss.Scenario)
+	if err != nil {
+		return res, err
+	}
+
+	res.Wire.label(ss.Scenario, res.Timing)
+
+	// The chains are validated again outside the timed handshake, which is
+	// over for both peers.
+	if err := res.timeVerification(ss.Scenario, ss.clientConfig, ss.serverConfig); err != nil {
+		return res, err
+	}
+
+	if ss.Scenario.Auth == MutualAuth {
+		res.DCUsed = res.ServerState.VerifiedDC
+	} else {
+		res.DCUsed = res.ClientState.VerifiedDC
+	}
+
+	return res, nil
+}
+
+// Run builds the configurations for s and measures one handshake.
+func Run(s Scenario) (Result, error) {
+	ss, err := NewSession(s)
+	if err != nil {
+		return Result{}, err
+	}
+	return ss.Handshake()
+}
+
+// Repeat measures n handshakes of s after discarding warmup ones. It stops at
+// the first failed handshake, returning the results gathered so far.
+func Repeat(s Scenario, warmup, n int) ([]Result, error) {
+	ss, err := NewSession(s)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < warmup; i++ {
+		if _, err := ss.Handshake(); err != nil {
+			return nil, fmt.Errorf("warm-up handshake %d: %v", i, err)
+		}
+	}
+
+	results := make([]Result, 0, n)
+	for i := 0; i < n; i++ {
+		res, err := ss.Handshake()
+		if err != nil {
+			return results, fmt.Errorf("handshake %d: %v", i, err)
+		}
+		results = append(results, res)
+	}
+
+	return results, nil
+}
+
+// Succeeded reports whether res used every feature s was meant to exercise.
+func (s Scenario) Succeeded(res Result) bool {
+	if s.Resumption != NoResumption {
+		// No certificate is sent when resuming.
+		return res.ClientState.DidResume && res.ServerState.DidResume
+	}
+	switch s.Protocol {
+	case PQTLS:
+		return res.DCUsed && res.PQTLSUsed
+	case KEMTLS:
+		return res.DCUsed && res.KEMTLSUsed
+	case KEMTLSPDK:
+		// The server's certificate is not sent, so there is no server
+		// delegated credential to verify, but a server that sends one ran
+		// a full KEMTLS handshake instead.
+		pdk := res.KEMTLSUsed && res.Timing.ServerTimingInfo.WriteCertificate == 0
+		if s.Auth == MutualAuth {
+			return pdk && res.DCUsed && res.ServerState.DidClientAuthentication
+		}
+		return pdk
+	}
+	if s.Auth == MutualAuth {
+		return res.DCUsed && res.ServerState.DidClientAuthentication
+	}
+	return res.DCUsed && !res.ClientState.DidClientAuthentication
+}
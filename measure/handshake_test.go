@@ -0,0 +1,31 @@
+package measure
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+)
+
+func TestClientDataAfterServerFinished(t *testing.T) {
+	ms := time.Millisecond
+	// The server started at 2ms and wrote its Finished 3ms later.
+	server := Event{
+		Side:  ServerSide,
+		At:    10 * ms,
+		Event: tls.CFEventTLS13ServerHandshakeTimingInfo{WriteServerFinished: 3 * ms, FullProtocol: 8 * ms},
+	}
+	for _, tt := range []struct {
+		name string
+		res  Result
+		want time.Duration
+	}{
+		{"after", Result{Events: []Event{server}, Latency: Latency{ClientData: 7 * ms}}, 2 * ms},
+		{"before", Result{Events: []Event{server}, Latency: Latency{ClientData: 4 * ms}}, -1 * ms},
+		{"no client data", Result{Events: []Event{server}}, 0},
+		{"no server event", Result{Latency: Latency{ClientData: 7 * ms}}, 0},
+	} {
+		if got := tt.res.ClientDataAfterServerFinished(); got != tt.want {
+			t.Errorf("%s: ClientDataAfterServerFinished() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package measure
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// HTTP versions.
+const (
+	HTTP1 = "1.1"
+	HTTP2 = "2"
+)
+
+// HTTPOptions configures the page loads of an HTTP test.
+type HTTPOptions struct {
+	// Version is HTTP1 or HTTP2, negotiated with ALPN.
+	Version string
+
+	// Resources are the sizes of the resources of the page. The first is the
+	// document, fetched on its own; the others are then fetched
+	// concurrently, over up to six connections with HTTP/1.1 and over the
+	// document's connection with HTTP/2.
+	Resources []int
+
+	// Pages is the number of page loads, each from a new client that has to
+	// handshake again.
+	Pages int
+}
+
+// ParseResources parses comma-separated resource sizes in bytes, where
+// "size x count" stands for count resources of size, e.g. "14000,2000x8".
+func ParseResources(spec string) ([]int, error) {
+	var sizes []int
+	for _, e := range strings.Split(spec, ",") {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		count := 1
+		if i := strings.Index(e, "x"); i >= 0 {
+			n, err := strconv.Atoi(e[i+1:])
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid resource count in %q", e)
+			}
+			e, count = e[:i], n
+		}
+		size, err := strconv.Atoi(e)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid resource size %q", e)
+		}
+		for i := 0; i < count; i++ {
+			sizes = append(sizes, size)
+		}
+	}
+	if len(sizes) == 0 {
+		return nil, errors.New("a page needs at least a document")
+	}
+	return sizes, nil
+}
+
+// HTTPResult is the outcome of an HTTP test of a scenario.
+type HTTPResult struct {
+	Scenario Scenario
+	Options  HTTPOptions
+
+	// Proto is the protocol of the responses, e.g. HTTP/2.0.
+	Proto string
+
+	// FirstByte is, for every page load, the time from dialing until the
+	// first byte of the document's response, and Page the time until every
+	// resource was read.
+	FirstByte []time.Duration
+	Page      []time.Duration
+	Errors    int
+	FirstErr  error
+}
+
+// emulatedListener emulates a link on every connection it accepts.
+type emulatedListener struct {
+	net.Listener
+	link Link
+}
+
+func (l emulatedListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return newEmulatedConn(c, l.link), nil
+}
+
+// resourceHandler serves /<n> with n bytes.
+func resourceHandler(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+	if err != nil || n < 0 {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(n))
+	w.Write(payload(serverMsg, n))
+}
+
+// HTTPTest loads a page from a local HTTP server opts.Pages times, each
+// time with a new client, over the configurations of s.
+func HTTPTest(s Scenario, opts HTTPOptions) (HTTPResult, error) {
+	hr := HTTPResult{Scenario: s, Options: opts}
+	if opts.Version != HTTP1 && opts.Version != HTTP2 {
+		return hr, fmt.Errorf("unknown HTTP version %q, want %s or %s", opts.Version, HTTP1, HTTP2)
+	}
+	if len(opts.Resources) == 0 {
+		return hr, errors.New("a page needs at least a document")
+	}
+
+	ss, err := NewSession(s)
+	if err != nil {
+		return hr, err
+	}
+
+	serverConfig := ss.serverConfig.Clone()
+	serverConfig.NextProtos = []string{"h2", "http/1.1"}
+	srv := &http.Server{Handler: http.HandlerFunc(resourceHandler), TLSConfig: serverConfig}
+	ln := newLocalListener()
+	go srv.Serve(tls.NewListener(emulatedListener{ln, s.Link}, serverConfig))
+	defer srv.Close()
+
+	for i := 0; i < opts.Pages; i++ {
+		firstByte, page, proto, err := loadPage(ln.Addr().String(), ss.clientConfig, s.Link, opts)
+		if err != nil {
+			hr.Errors++
+			if hr.FirstErr == nil {
+				hr.FirstErr = err
+			}
+			continue
+		}
+		hr.Proto = proto
+		hr.FirstByte = append(hr.FirstByte, firstByte)
+		hr.Page = append(hr.Page, page)
+	}
+	return hr, nil
+}
+
+// loadPage fetches the resources of opts from addr with a new client, and
+// returns the time to the first byte of the document, the time to the whole
+// page and the protocol of the responses.
+func loadPage(addr string, config *tls.Config, link Link, opts HTTPOptions) (time.Duration, time.Duration, string, error) {
+	transport := &http.Transport{
+		TLSClientConfig: config.Clone(),
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			// The round trip of the TCP handshake.
+			time.Sleep(2 * link.Delay)
+			return newEmulatedConn(conn, link), nil
+		},
+	}
+	if opts.Version == HTTP2 {
+		transport.ForceAttemptHTTP2 = true
+	} else {
+		// A non-nil map disables HTTP/2.
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		transport.TLSClientConfig.NextProtos = []string{"http/1.1"}
+		transport.MaxConnsPerHost = 6
+	}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport}
+
+	start := time.Now()
+	var firstByte time.Duration
+	trace := &httptrace.ClientTrace{
+		GotFirstResponseByte: func() { firstByte = time.Since(start) },
+	}
+	ctx := httptrace.WithClientTrace(context.Background(), trace)
+	proto, err := fetch(ctx, client, addr, opts.Resources[0])
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(opts.Resources))
+	for _, size := range opts.Resources[1:] {
+		wg.Add(1)
+		go func(size int) {
+			defer wg.Done()
+			if _, err := fetch(context.Background(), client, addr, size); err != nil {
+				errs <- err
+			}
+		}(size)
+	}
+	wg.Wait()
+	page := time.Since(start)
+	close(errs)
+	if err := <-errs; err != nil {
+		return 0, 0, "", err
+	}
+	return firstByte, page, proto, nil
+}
+
+// fetch gets a resource of size bytes and reads it.
+func fetch(ctx context.Context, client *http.Client, addr string, size int) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("https://%s/%d", addr, size), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	n, err := io.Copy(ioutil.Discard, resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK || n != int64(size) {
+		return "", fmt.Errorf("GET /%d: %s with %d bytes", size, resp.Status, n)
+	}
+	return resp.Proto, nil
+}
+
+// PrintHTTP writes the time to the first byte and to the whole page of
+// every HTTP test in results to w.
+func PrintHTTP(w io.Writer, results []HTTPResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Protocol\tAuth\tChain\tLink\tHTTP\tResources\tPages\tErrors\tTTFB median\tTTFB p95\tPage median\tPage p95\t")
+	for _, hr := range results {
+		ttfb := Summarize(hr.FirstByte)
+		page := Summarize(hr.Page)
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%s\t%d\t%d\t%d\t%v\t%v\t%v\t%v\t\n",
+			hr.Scenario.Protocol, hr.Scenario.Auth, hr.Scenario.Chain, hr.Scenario.Link, hr.Proto, len(hr.Options.Resources), len(hr.Page), hr.Errors,
+			ttfb.Median, ttfb.P95, page.Median, page.P95)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,160 @@
+package measure
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	kemschemes "circl/kem/schemes"
+)
+
+// The key_exchange of the classical groups in a KeyShareEntry, see RFC 8446,
+// Section 4.2.8.2: the X25519 public key and uncompressed NIST points.
+var classicalKeyShareSizes = map[tls.CurveID]int{
+	tls.X25519:    32,
+	tls.CurveP256: 65,
+	tls.CurveP384: 97,
+	tls.CurveP521: 133,
+}
+
+// keyShareSize returns the size of the key_exchange a client sends for
+// group: the public key of its KEM for the post-quantum groups.
+func keyShareSize(group tls.CurveID) (int, error) {
+	if n, ok := classicalKeyShareSizes[group]; ok {
+		return n, nil
+	}
+	for _, name := range kemSchemeNames[group] {
+		if scheme := kemschemes.ByName(name); scheme != nil {
+			return scheme.PublicKeySize(), nil
+		}
+	}
+	return 0, fmt.Errorf("%s: no KEM implementation available", CurveName(group))
+}
+
+// extraShareBytes returns how much offering group, with a key share, adds to
+// a ClientHello: its entry in supported_groups and its KeyShareEntry, the
+// group and the length of the key_exchange before it.
+func extraShareBytes(group tls.CurveID) (int, error) {
+	n, err := keyShareSize(group)
+	if err != nil {
+		return 0, err
+	}
+	return 2 + 2 + 2 + n, nil
+}
+
+// keyShareStrategy is one way for a client to pick the key shares of its
+// ClientHello, as priced by PrintKeyShareStrategies.
+type keyShareStrategy struct {
+	name       string
+	shares     int
+	helloBytes int // both ClientHellos after a HelloRetryRequest
+	roundTrips int
+	latency    string
+	source     string
+	err        error
+}
+
+// keyShareStrategies returns the strategies of a client supporting every one
+// of groups against a server that only supports the group of predicted, a
+// scenario where the client offers that group alone. mispredicted is the
+// scenario where the client offers next, the group after it in groups,
+// first, nil if it was not measured.
+//
+// crypto/tls only sends a key share for the first group a client offers, so
+// the single-share strategies are measured. Those sending several or all
+// shares are computed from the measured ClientHello of predicted, with one
+// more group and key share per extra group, and avoid the HelloRetryRequest
+// in a single round trip; their latency, which adds a key generation per
+// extra share, is not measured.
+func keyShareStrategies(predicted, mispredicted *SweepResult, groups []tls.CurveID, next tls.CurveID) []keyShareStrategy {
+	latencyStep, _ := LookupStep(ClientSide, "HandshakeLatency")
+	measured := func(name string, sr *SweepResult) keyShareStrategy {
+		st := keyShareStrategy{name: name, shares: 1, source: "measured", err: sr.Err}
+		if len(sr.Results) > 0 {
+			ws := sr.Results[0].Wire
+			st.helloBytes = ws.Client.MessageSize("ClientHello") + ws.Client.MessageSize(secondClientHello)
+			st.roundTrips = ws.Client.MessageCount("ClientHello") + ws.Client.MessageCount(secondClientHello)
+			st.latency = Summarize(StepSamples(latencyStep, sr.Results)).Median.String()
+		}
+		return st
+	}
+	computed := func(name string, extra []tls.CurveID) keyShareStrategy {
+		st := measured(name, predicted)
+		st.shares += len(extra)
+		st.latency = "-"
+		st.source = "computed"
+		for _, g := range extra {
+			n, err := extraShareBytes(g)
+			if err != nil {
+				st.err = err
+				return st
+			}
+			st.helloBytes += n
+		}
+		return st
+	}
+
+	g := predicted.Scenario.ServerGroups[0]
+	strategies := []keyShareStrategy{measured("one share, predicted", predicted)}
+	if mispredicted != nil {
+		strategies = append(strategies, measured("one share, mispredicted", mispredicted))
+	}
+	if next != g {
+		strategies = append(strategies, computed("two shares", []tls.CurveID{next}))
+	}
+	var others []tls.CurveID
+	for _, o := range groups {
+		if o != g {
+			others = append(others, o)
+		}
+	}
+	if len(others) > 1 {
+		strategies = append(strategies, computed("all shares", others))
+	}
+	return strategies
+}
+
+// PrintKeyShareStrategies writes, for every scenario in sweep where the
+// client predicted the server's group, what each key share strategy of a
+// client supporting all of groups costs: the shares it sends, the bytes of
+// its ClientHellos, their round trips and the handshake latency. sweep
+// holds the scenarios of a Matrix with Mispredict set.
+func PrintKeyShareStrategies(w io.Writer, sweep []SweepResult, groups []tls.CurveID) {
+	// The scenario of a mispredicting client, by the scenario of the
+	// predicting one, which only differs by its groups.
+	mispredicted := map[string]*SweepResult{}
+	for i := range sweep {
+		s := sweep[i].Scenario
+		if len(s.ClientGroups) > 1 {
+			s.ClientGroups = nil
+			mispredicted[s.String()] = &sweep[i]
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Protocol\tAuth\tServer group\tStrategy\tShares\tClientHello bytes\tRound trips\tLatency median\tSource\tError")
+	for i := range sweep {
+		s := sweep[i].Scenario
+		if len(s.ClientGroups) != 1 {
+			continue
+		}
+		g := s.ClientGroups[0]
+		next := g
+		for j, o := range groups {
+			if o == g {
+				next = groups[(j+1)%len(groups)]
+			}
+		}
+		s.ClientGroups = nil
+		for _, st := range keyShareStrategies(&sweep[i], mispredicted[s.String()], groups, next) {
+			errStr := ""
+			if st.err != nil {
+				errStr = st.err.Error()
+			}
+			fmt.Fprintf(tw, "%v\t%v\t%s\t%s\t%d\t%d\t%d\t%s\t%s\t%s\n",
+				s.Protocol, s.Auth, CurveName(g), st.name, st.shares, st.helloBytes, st.roundTrips, st.latency, st.source, errStr)
+		}
+	}
+	tw.Flush()
+}
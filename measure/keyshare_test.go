@@ -0,0 +1,52 @@
+package measure
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestKeyShareStrategies(t *testing.T) {
+	groups := []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384}
+	hellos := func(sizes ...int) []Result {
+		msgs := []MessageSize{{"ClientHello", sizes[0]}}
+		if len(sizes) > 1 {
+			msgs = append(msgs, MessageSize{secondClientHello, sizes[1]})
+		}
+		return []Result{{Wire: WireStats{Client: FlightStats{Messages: msgs}}}}
+	}
+	predicted := SweepResult{
+		Scenario: Scenario{ServerGroups: []tls.CurveID{tls.X25519}, ClientGroups: []tls.CurveID{tls.X25519}},
+		Results:  hellos(200),
+	}
+	mispredicted := SweepResult{
+		Scenario: Scenario{ServerGroups: []tls.CurveID{tls.X25519}, ClientGroups: []tls.CurveID{tls.CurveP256, tls.X25519}},
+		Results:  hellos(235, 202),
+	}
+
+	want := []struct {
+		name                      string
+		shares, bytes, roundTrips int
+	}{
+		{"one share, predicted", 1, 200, 1},
+		{"one share, mispredicted", 1, 235 + 202, 2},
+		// P-256 adds a group, its length and 65 bytes to the share list, and
+		// a group to supported_groups.
+		{"two shares", 2, 200 + 6 + 65, 1},
+		{"all shares", 3, 200 + 6 + 65 + 6 + 97, 1},
+	}
+	got := keyShareStrategies(&predicted, &mispredicted, groups, tls.CurveP256)
+	if len(got) != len(want) {
+		t.Fatalf("got %d strategies, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		st := got[i]
+		if st.name != w.name || st.shares != w.shares || st.helloBytes != w.bytes || st.roundTrips != w.roundTrips || st.err != nil {
+			t.Errorf("strategy %d = %+v, want %+v", i, st, w)
+		}
+	}
+
+	// Without a third group, all shares are the two shares.
+	if got := keyShareStrategies(&predicted, nil, groups[:2], tls.CurveP256); len(got) != 2 {
+		t.Errorf("got %d strategies for two groups and no misprediction, want 2", len(got))
+	}
+}
@@ -0,0 +1,327 @@
+package measure
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// LoadOptions configures a load test. A closed-loop test runs Clients
+// goroutines that each start a new handshake as soon as their previous one
+// is over. An open-loop test, selected by setting Rate, starts handshakes
+// at Rate per second whether or not the previous ones completed, so that
+// the latency includes the time spent queueing at a saturated server.
+type LoadOptions struct {
+	Clients int
+
+	// Rate is the number of handshakes started per second, at fixed
+	// intervals or, if Poisson is set, with exponentially distributed ones.
+	Rate    float64
+	Poisson bool
+
+	Duration time.Duration
+	// Warmup is discarded from the start of the test.
+	Warmup time.Duration
+}
+
+func (o LoadOptions) String() string {
+	switch {
+	case o.Rate > 0 && o.Poisson:
+		return fmt.Sprintf("%g/s poisson", o.Rate)
+	case o.Rate > 0:
+		return fmt.Sprintf("%g/s", o.Rate)
+	}
+	return fmt.Sprintf("%d clients", o.Clients)
+}
+
+// LoadResult is the outcome of a load test of a scenario.
+type LoadResult struct {
+	Scenario Scenario
+	Options  LoadOptions
+
+	// Completed is the number of handshakes the server completed during
+	// the measured part of the test, after the warmup and until the last
+	// client was started, whenever they began. Handshakes still running then
+	// are not counted, so that draining them does not lower the rate.
+	Completed int
+	// Latencies holds the wall-clock time to the end of the handshake of
+	// every handshake started after the warmup: from dialing in a closed
+	// loop and from the scheduled start in an open one.
+	Latencies []time.Duration
+	Errors    int
+	FirstErr  error
+	// DialErrors counts the connections the clients could not open, e.g.
+	// for lack of file descriptors or ports. They are not handshake
+	// failures and are left out of Errors.
+	DialErrors   int
+	FirstDialErr error
+
+	// ServerCPU is the CPU time the server threads spent in the Completed
+	// handshakes, over the measured duration.
+	ServerCPU CPUTime
+}
+
+// Rate returns the handshakes completed per second during the measured part
+// of the test.
+func (lr LoadResult) Rate() float64 {
+	if lr.Options.Duration <= 0 {
+		return 0
+	}
+	return float64(lr.Completed) / lr.Options.Duration.Seconds()
+}
+
+// ServerCPUPerHandshake returns the mean server CPU time of a handshake.
+func (lr LoadResult) ServerCPUPerHandshake() time.Duration {
+	if lr.Completed == 0 {
+		return 0
+	}
+	return lr.ServerCPU.Total() / time.Duration(lr.Completed)
+}
+
+// loadServer is a long-lived server accepting connections in a loop and
+// running one handshake and message exchange on each.
+type loadServer struct {
+	ln     net.Listener
+	config *tls.Config
+	link   Link
+
+	wg sync.WaitGroup
+
+	mu         sync.Mutex
+	measureAt  time.Time // handshakes completed outside are not counted
+	stopAt     time.Time
+	cpu        CPUTime
+	handshakes int
+}
+
+func (srv *loadServer) serve() {
+	defer srv.wg.Done()
+	for {
+		conn, err := srv.ln.Accept()
+		if ne, ok := err.(net.Error); ok && ne.Temporary() {
+			// Most likely out of file descriptors: let some connections end.
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		if err != nil {
+			return
+		}
+		srv.wg.Add(1)
+		go srv.handle(conn)
+	}
+}
+
+func (srv *loadServer) handle(conn net.Conn) {
+	defer srv.wg.Done()
+	server := tls.Server(newEmulatedConn(conn, srv.link), srv.config)
+	defer server.Close()
+
+	// Each handshake holds its own thread while it runs, so that the CPU
+	// time it reads is that of the server alone.
+	var err error
+	cpu := measureCPU(func() { err = server.Handshake() })
+	if err != nil {
+		return
+	}
+	end := time.Now()
+
+	srv.mu.Lock()
+	if !end.Before(srv.measureAt) && end.Before(srv.stopAt) {
+		srv.cpu.User += cpu.User
+		srv.cpu.System += cpu.System
+		srv.handshakes++
+	}
+	srv.mu.Unlock()
+
+	buf := make([]byte, len(clientMsg))
+	if _, err := io.ReadFull(server, buf); err != nil {
+		return
+	}
+	server.Write([]byte(serverMsg))
+}
+
+// LoadTest runs a load test of s against a single long-lived server.
+func LoadTest(s Scenario, opts LoadOptions) (LoadResult, error) {
+	lr := LoadResult{Scenario: s, Options: opts}
+	if opts.Rate <= 0 && opts.Clients < 1 {
+		return lr, errors.New("a load test needs at least one client or a positive rate")
+	}
+
+	// The session provides the configurations and, for KEMTLS-PDK, the
+	// server certificate cached by the client.
+	ss, err := NewSession(s)
+	if err != nil {
+		return lr, err
+	}
+
+	start := time.Now()
+	measureAt := start.Add(opts.Warmup)
+	stopAt := measureAt.Add(opts.Duration)
+	srv := &loadServer{
+		ln:        newLocalListener(),
+		config:    ss.serverConfig,
+		link:      s.Link,
+		measureAt: measureAt,
+		stopAt:    stopAt,
+	}
+	srv.wg.Add(1)
+	go srv.serve()
+
+	var mu sync.Mutex
+	// handshake runs a handshake meant to start at begin and records it.
+	handshake := func(begin time.Time) {
+		end, err := loadHandshake(srv.ln.Addr().String(), ss.clientConfig, s.Link)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if begin.Before(measureAt) {
+			return
+		}
+		if de, ok := err.(dialError); ok {
+			lr.DialErrors++
+			if lr.FirstDialErr == nil {
+				lr.FirstDialErr = de.err
+			}
+			return
+		}
+		if err != nil {
+			lr.Errors++
+			if lr.FirstErr == nil {
+				lr.FirstErr = err
+			}
+			return
+		}
+		lr.Latencies = append(lr.Latencies, end.Sub(begin))
+	}
+
+	var clients sync.WaitGroup
+	if opts.Rate > 0 {
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+		interval := float64(time.Second) / opts.Rate
+		for next := start; next.Before(stopAt); {
+			time.Sleep(time.Until(next))
+			clients.Add(1)
+			go func(begin time.Time) {
+				defer clients.Done()
+				handshake(begin)
+			}(next)
+
+			if opts.Poisson {
+				next = next.Add(time.Duration(r.ExpFloat64() * interval))
+			} else {
+				next = next.Add(time.Duration(interval))
+			}
+		}
+	} else {
+		for i := 0; i < opts.Clients; i++ {
+			clients.Add(1)
+			go func() {
+				defer clients.Done()
+				for time.Now().Before(stopAt) {
+					handshake(time.Now())
+				}
+			}()
+		}
+	}
+	clients.Wait()
+	srv.ln.Close()
+	srv.wg.Wait()
+	lr.Completed = srv.handshakes
+	lr.ServerCPU = srv.cpu
+	lr.ServerCPU.Wall = opts.Duration
+
+	return lr, nil
+}
+
+// Saturated reports whether the server could not keep up with the offered
+// rate of an open-loop test: it completed fewer handshakes than offered, by
+// more than rateSlack allows, more than 1% of the handshakes failed, or the
+// median latency more than doubled compared to base, the test at the lowest
+// rate. Connections the clients failed to open do not count as failures.
+func (lr LoadResult) Saturated(base LoadResult) bool {
+	total := len(lr.Latencies) + lr.Errors
+	if total == 0 || float64(lr.Errors) > 0.01*float64(total) {
+		return true
+	}
+	offered := lr.Options.Rate * lr.Options.Duration.Seconds()
+	if float64(lr.Completed) < offered-rateSlack(offered) {
+		return true
+	}
+	return Summarize(lr.Latencies).Median > 2*Summarize(base.Latencies).Median
+}
+
+// rateSlack returns how many fewer than offered handshakes a server keeping
+// up may complete: 5% of them, or three standard deviations of a Poisson
+// count of offered arrivals, sqrt(offered), when the test is too short for
+// 5% to cover chance.
+func rateSlack(offered float64) float64 {
+	return math.Max(0.05*offered, 3*math.Sqrt(offered))
+}
+
+// Knee returns the index of the first saturated test in results, open-loop
+// tests of a scenario by increasing rate, or -1 if none is.
+func Knee(results []LoadResult) int {
+	for i, lr := range results {
+		if lr.Saturated(results[0]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// dialError is an error of the client opening its connection.
+type dialError struct {
+	err error
+}
+
+func (e dialError) Error() string {
+	return e.err.Error()
+}
+
+// loadHandshake dials addr, completes a handshake and exchanges the test
+// messages. It returns when the handshake was over; over an emulated link
+// the round trip of the TCP handshake comes first.
+func loadHandshake(addr string, config *tls.Config, link Link) (time.Time, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return time.Time{}, dialError{err}
+	}
+	time.Sleep(2 * link.Delay)
+	client := tls.Client(newEmulatedConn(conn, link), config)
+	defer client.Close()
+
+	if err := client.Handshake(); err != nil {
+		return time.Time{}, err
+	}
+	end := time.Now()
+
+	if _, err := client.Write([]byte(clientMsg)); err != nil {
+		return time.Time{}, err
+	}
+	buf := make([]byte, len(serverMsg))
+	if _, err := io.ReadFull(client, buf); err != nil {
+		return time.Time{}, fmt.Errorf("reading the server's message: %v", err)
+	}
+	return end, nil
+}
+
+// PrintLoad writes the throughput, latency percentiles and server CPU cost of
+// every load test in results to w, and the cores the server kept busy.
+func PrintLoad(w io.Writer, results []LoadResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Protocol\tAuth\tChain\tLink\tLoad\tHandshakes\tErrors\tDial errors\tHandshakes/s\tP50\tP90\tP99\tMax\tServer CPU/handshake\tServer cores\t")
+	for _, lr := range results {
+		sum := Summarize(lr.Latencies)
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%d\t%d\t%d\t%.1f\t%v\t%v\t%v\t%v\t%v\t%.2f\t\n",
+			lr.Scenario.Protocol, lr.Scenario.Auth, lr.Scenario.Chain, lr.Scenario.Link, lr.Options, lr.Completed, lr.Errors, lr.DialErrors,
+			lr.Rate(), sum.Median, sum.P90, sum.P99, sum.Max, lr.ServerCPUPerHandshake(), lr.ServerCPU.Ratio())
+	}
+	tw.Flush()
+}
@@ -0,0 +1,46 @@
+package measure
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSaturated(t *testing.T) {
+	latencies := func(n int, d time.Duration) []time.Duration {
+		l := make([]time.Duration, n)
+		for i := range l {
+			l[i] = d
+		}
+		return l
+	}
+	ms := time.Millisecond
+	base := LoadResult{Latencies: latencies(100, 2*ms)}
+	// 1000 handshakes offered, with a slack of 3*sqrt(1000) ≈ 95.
+	fast := LoadOptions{Rate: 100, Duration: 10 * time.Second}
+	// 100 handshakes offered, with a slack of 30.
+	slow := LoadOptions{Rate: 10, Duration: 10 * time.Second}
+
+	for _, tt := range []struct {
+		name string
+		lr   LoadResult
+		want bool
+	}{
+		{"keeping up", LoadResult{Options: fast, Completed: 1000, Latencies: latencies(1000, 2*ms)}, false},
+		{"within chance", LoadResult{Options: fast, Completed: 910, Latencies: latencies(910, 2*ms)}, false},
+		{"falling behind", LoadResult{Options: fast, Completed: 900, Latencies: latencies(1000, 2*ms)}, true},
+		{"short test within chance", LoadResult{Options: slow, Completed: 75, Latencies: latencies(75, 2*ms)}, false},
+		{"short test falling behind", LoadResult{Options: slow, Completed: 65, Latencies: latencies(65, 2*ms)}, true},
+		{"failing", LoadResult{Options: fast, Completed: 1000, Latencies: latencies(980, 2*ms), Errors: 20}, true},
+		{
+			"client out of ports",
+			LoadResult{Options: fast, Completed: 1000, Latencies: latencies(1000, 2*ms), DialErrors: 500},
+			false,
+		},
+		{"queueing", LoadResult{Options: fast, Completed: 1000, Latencies: latencies(1000, 5*ms)}, true},
+		{"nothing measured", LoadResult{Options: fast}, true},
+	} {
+		if got := tt.lr.Saturated(base); got != tt.want {
+			t.Errorf("%s: Saturated = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
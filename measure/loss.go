@@ -0,0 +1,87 @@
+package measure
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// LossModel is a Gilbert-Elliott channel. Before each segment it moves from
+// the good to the bad state with probability GoodToBad and back with
+// probability BadToGood, then loses the segment with the probability of its
+// current state. The zero LossModel loses nothing.
+type LossModel struct {
+	GoodToBad float64
+	BadToGood float64
+	LossGood  float64
+	LossBad   float64
+}
+
+// UniformLoss returns a model losing every segment independently with
+// probability rate.
+func UniformLoss(rate float64) LossModel {
+	return LossModel{LossGood: rate}
+}
+
+// GilbertElliottLoss returns a model losing segments in bursts of burst
+// segments on average, with an overall loss rate of rate. The bad state
+// loses every segment and the good state none.
+func GilbertElliottLoss(rate, burst float64) LossModel {
+	if rate <= 0 {
+		return LossModel{}
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	badToGood := 1 / burst
+	return LossModel{
+		GoodToBad: rate * badToGood / (1 - rate),
+		BadToGood: badToGood,
+		LossBad:   1,
+	}
+}
+
+// Rate returns the long-run fraction of segments lost.
+func (m LossModel) Rate() float64 {
+	if m.GoodToBad+m.BadToGood == 0 {
+		return m.LossGood
+	}
+	return (m.BadToGood*m.LossGood + m.GoodToBad*m.LossBad) / (m.GoodToBad + m.BadToGood)
+}
+
+// Burst returns the mean number of segments lost in a row once the bad
+// state is entered, 1 for independent losses.
+func (m LossModel) Burst() float64 {
+	if m.GoodToBad == 0 || m.BadToGood == 0 {
+		return 1
+	}
+	return 1 / m.BadToGood
+}
+
+func (m LossModel) String() string {
+	if m.GoodToBad == 0 {
+		return fmt.Sprintf("%.2g%% loss", 100*m.LossGood)
+	}
+	return fmt.Sprintf("%.2g%% loss in bursts of %.3g", 100*m.Rate(), m.Burst())
+}
+
+// lossChannel is the state of a LossModel for one direction.
+type lossChannel struct {
+	model LossModel
+	bad   bool
+}
+
+func (ch *lossChannel) lost(r *rand.Rand) bool {
+	if ch.bad {
+		if r.Float64() < ch.model.BadToGood {
+			ch.bad = false
+		}
+	} else if r.Float64() < ch.model.GoodToBad {
+		ch.bad = true
+	}
+
+	p := ch.model.LossGood
+	if ch.bad {
+		p = ch.model.LossBad
+	}
+	return r.Float64() < p
+}
@@ -0,0 +1,100 @@
+package measure
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// closeModels reports whether a and b only differ by rounding.
+func closeModels(a, b LossModel) bool {
+	for _, d := range []float64{a.GoodToBad - b.GoodToBad, a.BadToGood - b.BadToGood, a.LossGood - b.LossGood, a.LossBad - b.LossBad} {
+		if math.Abs(d) > 1e-12 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestLossModel(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		m     LossModel
+		want  LossModel
+		rate  float64
+		burst float64
+		str   string
+	}{
+		{"zero", LossModel{}, LossModel{}, 0, 1, "0% loss"},
+		{"uniform", UniformLoss(0.01), LossModel{LossGood: 0.01}, 0.01, 1, "1% loss"},
+		{
+			"bursts",
+			GilbertElliottLoss(0.1, 4),
+			LossModel{GoodToBad: 0.1 * 0.25 / 0.9, BadToGood: 0.25, LossBad: 1},
+			0.1, 4, "10% loss in bursts of 4",
+		},
+		{
+			// Bursts are at least one segment long.
+			"short bursts",
+			GilbertElliottLoss(0.1, 0.5),
+			LossModel{GoodToBad: 0.1 / 0.9, BadToGood: 1, LossBad: 1},
+			0.1, 1, "10% loss in bursts of 1",
+		},
+		{"no loss in bursts", GilbertElliottLoss(0, 4), LossModel{}, 0, 1, "0% loss"},
+	} {
+		if !closeModels(tt.m, tt.want) {
+			t.Errorf("%s: model %+v, want %+v", tt.name, tt.m, tt.want)
+		}
+		if got := tt.m.Rate(); math.Abs(got-tt.rate) > 1e-12 {
+			t.Errorf("%s: Rate() = %v, want %v", tt.name, got, tt.rate)
+		}
+		if got := tt.m.Burst(); math.Abs(got-tt.burst) > 1e-12 {
+			t.Errorf("%s: Burst() = %v, want %v", tt.name, got, tt.burst)
+		}
+		if got := tt.m.String(); got != tt.str {
+			t.Errorf("%s: String() = %q, want %q", tt.name, got, tt.str)
+		}
+	}
+}
+
+func TestLossChannel(t *testing.T) {
+	const segments = 1000000
+	for _, m := range []LossModel{
+		UniformLoss(0.05),
+		GilbertElliottLoss(0.05, 1),
+		GilbertElliottLoss(0.05, 4),
+		GilbertElliottLoss(0.2, 10),
+	} {
+		ch := lossChannel{model: m}
+		r := rand.New(rand.NewSource(1))
+		lost, runs, run := 0, 0, 0
+		for i := 0; i < segments; i++ {
+			if ch.lost(r) {
+				lost++
+				run++
+				continue
+			}
+			if run > 0 {
+				runs++
+				run = 0
+			}
+		}
+		if run > 0 {
+			runs++
+		}
+
+		rate := float64(lost) / segments
+		if math.Abs(rate-m.Rate()) > 0.05*m.Rate() {
+			t.Errorf("%v: lost %.4f of the segments, want %.4f", m, rate, m.Rate())
+		}
+		// Independent losses also run into each other, so only the bursts
+		// of the bad state are checked.
+		if m.GoodToBad == 0 {
+			continue
+		}
+		burst := float64(lost) / float64(runs)
+		if math.Abs(burst-m.Burst()) > 0.05*m.Burst() {
+			t.Errorf("%v: mean burst of %.3f segments, want %.3f", m, burst, m.Burst())
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package measure
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"sync"
+	"text/tabwriter"
+)
+
+// MemStats is what one peer allocated during its handshake. PeakHeap is
+// the largest growth of the live heap over its value at the start of the
+// handshake, sampled whenever the peer stopped to read or write; it also
+// holds what the other peer still keeps alive.
+type MemStats struct {
+	Bytes    uint64
+	Allocs   uint64
+	PeakHeap uint64
+}
+
+// MemoryUsage holds the MemStats of each peer.
+type MemoryUsage struct {
+	Client MemStats
+	Server MemStats
+}
+
+// lockstep lets a single peer run at a time, so that the process-wide
+// allocation counters can be attributed to it. A peer gives up its turn
+// whenever it reads from or writes to the connection, which is also when
+// the other peer can make progress.
+type lockstep struct {
+	turn     sync.Mutex
+	baseHeap uint64
+}
+
+func newLockstep() *lockstep {
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return &lockstep{baseHeap: ms.HeapAlloc}
+}
+
+// memMeter accounts the allocations of one peer.
+type memMeter struct {
+	ls      *lockstep
+	start   runtime.MemStats
+	stats   MemStats
+	stopped bool
+}
+
+func (ls *lockstep) meter() *memMeter {
+	return &memMeter{ls: ls}
+}
+
+// begin starts measuring the peer's handshake. A nil meter measures
+// nothing.
+func (m *memMeter) begin() {
+	if m != nil {
+		m.resume()
+	}
+}
+
+// resume waits for the peer's turn and starts counting.
+func (m *memMeter) resume() {
+	m.ls.turn.Lock()
+	runtime.ReadMemStats(&m.start)
+}
+
+// pause stops counting and gives the turn away.
+func (m *memMeter) pause() {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	m.stats.Bytes += ms.TotalAlloc - m.start.TotalAlloc
+	m.stats.Allocs += ms.Mallocs - m.start.Mallocs
+	if ms.HeapAlloc > m.ls.baseHeap && ms.HeapAlloc-m.ls.baseHeap > m.stats.PeakHeap {
+		m.stats.PeakHeap = ms.HeapAlloc - m.ls.baseHeap
+	}
+	m.ls.turn.Unlock()
+}
+
+// stop ends the measurement once the peer's handshake is over; the
+// connection is then used without taking turns.
+func (m *memMeter) stop() {
+	if m != nil {
+		m.pause()
+		m.stopped = true
+	}
+}
+
+// meteredConn gives up the peer's turn around every read and write, so
+// that only the peer's own work is counted; in particular the recording and
+// emulation of the layers below are not.
+type meteredConn struct {
+	net.Conn
+	m *memMeter
+}
+
+func (c *meteredConn) Read(b []byte) (int, error) {
+	if c.m.stopped {
+		return c.Conn.Read(b)
+	}
+	c.m.pause()
+	defer c.m.resume()
+	return c.Conn.Read(b)
+}
+
+func (c *meteredConn) Write(b []byte) (int, error) {
+	if c.m.stopped {
+		return c.Conn.Write(b)
+	}
+	c.m.pause()
+	defer c.m.resume()
+	return c.Conn.Write(b)
+}
+
+// metered returns c metered by m, or c itself if m is nil.
+func metered(c net.Conn, m *memMeter) net.Conn {
+	if m == nil {
+		return c
+	}
+	return &meteredConn{Conn: c, m: m}
+}
+
+// meanMemory returns the mean MemStats of each peer over results.
+func meanMemory(results []Result) MemoryUsage {
+	var mean MemoryUsage
+	if len(results) == 0 {
+		return mean
+	}
+	for _, res := range results {
+		mean.Client.add(res.Memory.Client)
+		mean.Server.add(res.Memory.Server)
+	}
+	n := uint64(len(results))
+	mean.Client.div(n)
+	mean.Server.div(n)
+	return mean
+}
+
+func (m *MemStats) add(o MemStats) {
+	m.Bytes += o.Bytes
+	m.Allocs += o.Allocs
+	m.PeakHeap += o.PeakHeap
+}
+
+func (m *MemStats) div(n uint64) {
+	m.Bytes /= n
+	m.Allocs /= n
+	m.PeakHeap /= n
+}
+
+// PrintMemory writes the mean allocations and peak heap of each peer over
+// results, measured by a scenario with Memory set, to w.
+func PrintMemory(w io.Writer, results []Result) {
+	if len(results) == 0 {
+		return
+	}
+
+	mean := meanMemory(results)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Side\tAllocated bytes\tAllocations\tPeak heap\t")
+	fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t\n", ClientSide, mean.Client.Bytes, mean.Client.Allocs, mean.Client.PeakHeap)
+	fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t\n", ServerSide, mean.Server.Bytes, mean.Server.Allocs, mean.Server.PeakHeap)
+	tw.Flush()
+}
+
+// PrintMemoryComparison writes the mean allocations and peak heap of each
+// peer in every scenario of sweep to w.
+func PrintMemoryComparison(w io.Writer, sweep []SweepResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Protocol\tAuth\tGroup\tScheme\tLoss\tClient bytes\tClient allocs\tClient peak\tServer bytes\tServer allocs\tServer peak\t")
+	for _, sr := range sweep {
+		s := sr.Scenario
+		mean := meanMemory(sr.Results)
+		fmt.Fprintf(tw, "%v\t%v\t%s\t%s\t%.3g%%\t%d\t%d\t%d\t%d\t%d\t%d\t\n",
+			s.Protocol, s.Auth, curveList(s.ClientGroups, ","), SchemeName(s.ServerScheme), 100*s.Link.Loss.Rate(),
+			mean.Client.Bytes, mean.Client.Allocs, mean.Client.PeakHeap,
+			mean.Server.Bytes, mean.Server.Allocs, mean.Server.PeakHeap)
+	}
+	tw.Flush()
+}
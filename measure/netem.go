@@ -0,0 +1,294 @@
+package measure
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+const defaultMSS = 1460
+
+// Link describes the network emulated between the client and the server.
+// The zero Link leaves the loopback connection untouched.
+type Link struct {
+	// Delay is the one-way propagation delay, varied uniformly by up to
+	// Jitter in each direction. Segments are never reordered.
+	Delay  time.Duration
+	Jitter time.Duration
+
+	// Bandwidth caps each direction, in bits per second. Zero is unlimited.
+	Bandwidth int64
+
+	// InitCwnd is the initial congestion window in segments. When set, each
+	// sender follows slow start: a round trip allows a window of data and
+	// the window grows by the data acknowledged. Zero disables it.
+	InitCwnd int
+
+	// MSS is the segment size, 1460 bytes if zero.
+	MSS int
+
+	// Loss decides which segments are lost. A lost segment is retransmitted
+	// after RTO, doubled on every further loss of the same segment, and holds
+	// back the segments behind it. After a loss slow start restarts from one
+	// segment. Fast retransmit is not emulated: handshake flights are rarely
+	// long enough to produce three duplicate acknowledgements.
+	Loss LossModel
+
+	// RTO is the retransmission timeout, 200ms plus the round trip if zero,
+	// like Linux's minimum RTO over a known round trip time.
+	RTO time.Duration
+}
+
+func (l Link) isZero() bool {
+	return l == Link{}
+}
+
+func (l Link) mss() int {
+	if l.MSS > 0 {
+		return l.MSS
+	}
+	return defaultMSS
+}
+
+func (l Link) rto() time.Duration {
+	if l.RTO > 0 {
+		return l.RTO
+	}
+	return 200*time.Millisecond + 2*l.Delay
+}
+
+func (l Link) String() string {
+	str := fmt.Sprintf("delay %v±%v", l.Delay, l.Jitter)
+	if l.Bandwidth > 0 {
+		str += fmt.Sprintf(", %d bit/s", l.Bandwidth)
+	}
+	if l.InitCwnd > 0 {
+		str += fmt.Sprintf(", initcwnd %d×%d", l.InitCwnd, l.mss())
+	}
+	if l.Loss != (LossModel{}) {
+		str += ", " + l.Loss.String()
+	}
+	return str
+}
+
+// segment is a chunk of written data and the time it reaches the peer.
+type segment struct {
+	b  []byte
+	at time.Time
+}
+
+// emulatedConn delays what is written to it according to a Link before
+// handing it to the underlying connection, so each peer's conn emulates
+// its sending direction.
+type emulatedConn struct {
+	net.Conn
+	link Link
+
+	mu          sync.Mutex
+	rand        *rand.Rand
+	linkFree    time.Time // when the previous segment left the sender
+	lastArrival time.Time
+	cwnd        int // bytes
+	inFlight    int // bytes sent in the current round trip
+	roundStart  time.Time
+	loss        lossChannel
+
+	queue     chan segment
+	done      chan struct{}
+	closeOnce sync.Once
+
+	errMu sync.Mutex
+	err   error
+}
+
+func newEmulatedConn(c net.Conn, link Link) net.Conn {
+	if link.isZero() {
+		return c
+	}
+
+	ec := &emulatedConn{
+		Conn:  c,
+		link:  link,
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+		loss:  lossChannel{model: link.Loss},
+		queue: make(chan segment, 1024),
+		done:  make(chan struct{}),
+	}
+	go ec.deliver()
+	return ec
+}
+
+func (c *emulatedConn) Write(b []byte) (int, error) {
+	c.errMu.Lock()
+	err := c.err
+	c.errMu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	written := 0
+	for len(b) > written {
+		n := len(b) - written
+		if n > c.link.mss() {
+			n = c.link.mss()
+		}
+		seg := segment{b: make([]byte, n)}
+		copy(seg.b, b[written:written+n])
+		now, seg.at = c.schedule(now, n)
+
+		select {
+		case c.queue <- seg:
+		case <-c.done:
+			return written, net.ErrClosed
+		}
+		written += n
+	}
+
+	return written, nil
+}
+
+// schedule returns when a segment of n bytes, written at now, leaves the
+// sender and when it arrives at the peer.
+func (c *emulatedConn) schedule(now time.Time, n int) (sent, arrival time.Time) {
+	sent = now
+	if c.link.InitCwnd > 0 {
+		sent = c.congestionWindow(now, n)
+	}
+
+	if sent.Before(c.linkFree) {
+		sent = c.linkFree
+	}
+	if c.link.Bandwidth > 0 {
+		sent = sent.Add(time.Duration(int64(n) * 8 * int64(time.Second) / c.link.Bandwidth))
+	}
+	c.linkFree = sent
+
+	arrival = sent.Add(c.link.Delay)
+	if c.link.Jitter > 0 {
+		arrival = arrival.Add(time.Duration(c.rand.Int63n(int64(2*c.link.Jitter)+1)) - c.link.Jitter)
+	}
+	for rto := c.link.rto(); c.loss.lost(c.rand); rto *= 2 {
+		arrival = arrival.Add(rto)
+		if c.link.InitCwnd > 0 {
+			c.cwnd = c.link.mss()
+			c.inFlight = 0
+		}
+	}
+	if arrival.Before(c.lastArrival) {
+		arrival = c.lastArrival
+	}
+	c.lastArrival = arrival
+
+	return sent, arrival
+}
+
+// congestionWindow returns the earliest time slow start lets n more bytes
+// be sent. Whatever was sent in a round trip is acknowledged, and added to
+// the window, one round trip later.
+func (c *emulatedConn) congestionWindow(now time.Time, n int) time.Time {
+	rtt := 2 * c.link.Delay
+	if c.cwnd == 0 {
+		c.cwnd = c.link.InitCwnd * c.link.mss()
+		c.roundStart = now
+	}
+
+	if now.Sub(c.roundStart) >= rtt {
+		c.cwnd += c.inFlight
+		c.inFlight = 0
+		c.roundStart = now
+	} else if c.inFlight > 0 && c.inFlight+n > c.cwnd {
+		c.roundStart = c.roundStart.Add(rtt)
+		c.cwnd += c.inFlight
+		c.inFlight = 0
+	}
+	c.inFlight += n
+
+	if now.Before(c.roundStart) {
+		return c.roundStart
+	}
+	return now
+}
+
+// deliver writes the queued segments to the underlying connection once
+// they are due. After Close it delivers what is still queued, like TCP
+// does after close, and then closes the underlying connection.
+func (c *emulatedConn) deliver() {
+	defer c.Conn.Close()
+	for {
+		var seg segment
+		select {
+		case seg = <-c.queue:
+		case <-c.done:
+			select {
+			case seg = <-c.queue:
+			default:
+				return
+			}
+		}
+
+		if d := time.Until(seg.at); d > 0 {
+			time.Sleep(d)
+		}
+
+		if _, err := c.Conn.Write(seg.b); err != nil {
+			c.errMu.Lock()
+			c.err = err
+			c.errMu.Unlock()
+			return
+		}
+	}
+}
+
+// SetDeadline only applies to reads: writes are queued, and a write
+// deadline, which crypto/tls sets to now after its close_notify, would
+// make the delivery of the queued segments fail.
+func (c *emulatedConn) SetDeadline(t time.Time) error {
+	return c.Conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline is ignored, see SetDeadline.
+func (c *emulatedConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// Close returns immediately; the underlying connection is closed once the
+// data written so far has been delivered.
+func (c *emulatedConn) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return nil
+}
+
+// connect returns the client end of a new connection and a function that
+// returns the server end, together with the host the client dialed. An
+// emulated link runs over an in-memory pipe, so that nothing but the
+// emulation shapes the traffic, after waiting one round trip for the TCP
+// handshake. Otherwise the peers use loopback TCP.
+func connect(link Link) (net.Conn, func() (net.Conn, error), string, error) {
+	if !link.isZero() {
+		clientConn, serverConn := net.Pipe()
+		time.Sleep(2 * link.Delay)
+		accept := func() (net.Conn, error) {
+			return newEmulatedConn(serverConn, link), nil
+		}
+		return newEmulatedConn(clientConn, link), accept, "127.0.0.1", nil
+	}
+
+	ln := newLocalListener()
+	clientConn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		ln.Close()
+		return nil, nil, "", err
+	}
+	accept := func() (net.Conn, error) {
+		defer ln.Close()
+		return ln.Accept()
+	}
+	host, _, _ := net.SplitHostPort(ln.Addr().String())
+	return clientConn, accept, host, nil
+}
@@ -0,0 +1,273 @@
+package measure
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"circl/kem"
+	kemschemes "circl/kem/schemes"
+)
+
+// Primitive kinds.
+const (
+	KindKEM       = "kem"
+	KindSignature = "signature"
+)
+
+// signedMessageLen is the size of what TLS 1.3 signs in CertificateVerify:
+// 64 spaces, the context string, a zero byte and a SHA-256 transcript hash.
+const signedMessageLen = 64 + 33 + 1 + 32
+
+// The circl schemes implementing each group, tried in order. The classical
+// groups are benchmarked as their HPKE DH-based KEM, whose key generation,
+// encapsulation and decapsulation are the ECDH operations of the handshake.
+var kemSchemeNames = map[tls.CurveID][]string{
+	tls.X25519:    {"HPKE_KEM_X25519_HKDF_SHA256", "X25519"},
+	tls.CurveP256: {"HPKE_KEM_P256_HKDF_SHA256", "P-256"},
+	tls.CurveP384: {"HPKE_KEM_P384_HKDF_SHA384", "P-384"},
+	tls.CurveP521: {"HPKE_KEM_P521_HKDF_SHA512", "P-521"},
+	tls.SIKEp434:  {"SIKEp434"},
+	tls.Kyber512:  {"Kyber512"},
+}
+
+// authKEMs maps each KEMTLS authentication scheme to the KEM behind it.
+var authKEMs = map[tls.SignatureScheme]tls.CurveID{
+	tls.KEMTLSWithSIKEp434: tls.SIKEp434,
+	tls.KEMTLSWithKyber512: tls.Kyber512,
+}
+
+// operation is one timed operation of a primitive. The operations of a
+// primitive share a key pair and ciphertext or signature generated upfront,
+// so each can run on its own.
+type operation struct {
+	name string
+	run  func() error
+}
+
+// primitive is a key exchange group or an authentication scheme.
+type primitive struct {
+	name          string
+	kind          string
+	publicKeySize int
+	outputSize    int // ciphertext or signature
+	ops           []operation
+}
+
+// primitives returns every group in curveNames and every scheme in
+// schemeNames, and the error of each one this toolchain does not provide.
+func primitives() ([]primitive, []error) {
+	var ps []primitive
+	var errs []error
+	for _, c := range curveNames {
+		p, err := newKEMPrimitive(c.name, c.id)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ps = append(ps, p)
+	}
+	for _, s := range schemeNames {
+		var p primitive
+		var err error
+		switch {
+		case s.kind == kemAuthentication:
+			p, err = newKEMPrimitive(s.name, authKEMs[s.scheme])
+		case s.scheme == tls.ECDSAWithP256AndSHA256:
+			p, err = newECDSAPrimitive(s.name, elliptic.P256())
+		case s.scheme == tls.ECDSAWithP384AndSHA384:
+			p, err = newECDSAPrimitive(s.name, elliptic.P384())
+		case s.scheme == tls.ECDSAWithP521AndSHA512:
+			p, err = newECDSAPrimitive(s.name, elliptic.P521())
+		default:
+			p, err = newSignPrimitive(s.name, s.scheme)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ps = append(ps, p)
+	}
+	return ps, errs
+}
+
+func newKEMPrimitive(name string, id tls.CurveID) (primitive, error) {
+	var scheme kem.Scheme
+	for _, n := range kemSchemeNames[id] {
+		if scheme = kemschemes.ByName(n); scheme != nil {
+			break
+		}
+	}
+	if scheme == nil {
+		return primitive{}, fmt.Errorf("%s: no KEM implementation available", name)
+	}
+
+	pk, sk, err := scheme.GenerateKeyPair()
+	if err != nil {
+		return primitive{}, fmt.Errorf("%s: %v", name, err)
+	}
+	ct, _, err := scheme.Encapsulate(pk)
+	if err != nil {
+		return primitive{}, fmt.Errorf("%s: %v", name, err)
+	}
+
+	return primitive{
+		name:          name,
+		kind:          KindKEM,
+		publicKeySize: scheme.PublicKeySize(),
+		outputSize:    scheme.CiphertextSize(),
+		ops: []operation{
+			{"KeyGen", func() error {
+				_, _, err := scheme.GenerateKeyPair()
+				return err
+			}},
+			{"Encapsulate", func() error {
+				_, _, err := scheme.Encapsulate(pk)
+				return err
+			}},
+			{"Decapsulate", func() error {
+				_, err := scheme.Decapsulate(sk, ct)
+				return err
+			}},
+		},
+	}, nil
+}
+
+func newSignPrimitive(name string, id tls.SignatureScheme) (primitive, error) {
+	scheme := signScheme(id)
+	if scheme == nil {
+		return primitive{}, fmt.Errorf("%s: no signature implementation available", name)
+	}
+
+	pk, sk, err := scheme.GenerateKey()
+	if err != nil {
+		return primitive{}, fmt.Errorf("%s: %v", name, err)
+	}
+	msg := make([]byte, signedMessageLen)
+	sig := scheme.Sign(sk, msg, nil)
+
+	return primitive{
+		name:          name,
+		kind:          KindSignature,
+		publicKeySize: scheme.PublicKeySize(),
+		outputSize:    scheme.SignatureSize(),
+		ops: []operation{
+			{"KeyGen", func() error {
+				_, _, err := scheme.GenerateKey()
+				return err
+			}},
+			{"Sign", func() error {
+				scheme.Sign(sk, msg, nil)
+				return nil
+			}},
+			{"Verify", func() error {
+				if !scheme.Verify(pk, msg, sig, nil) {
+					return errors.New("invalid signature")
+				}
+				return nil
+			}},
+		},
+	}, nil
+}
+
+// newECDSAPrimitive signs a SHA-256 digest on every curve: the cost of
+// ECDSA does not depend on the hash, which is part of the TLS logic.
+func newECDSAPrimitive(name string, curve elliptic.Curve) (primitive, error) {
+	priv, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return primitive{}, fmt.Errorf("%s: %v", name, err)
+	}
+	digest := sha256.Sum256(make([]byte, signedMessageLen))
+	sig, err := ecdsa.SignASN1(rand.Reader, priv, digest[:])
+	if err != nil {
+		return primitive{}, fmt.Errorf("%s: %v", name, err)
+	}
+
+	return primitive{
+		name:          name,
+		kind:          KindSignature,
+		publicKeySize: len(elliptic.Marshal(curve, priv.X, priv.Y)),
+		outputSize:    len(sig),
+		ops: []operation{
+			{"KeyGen", func() error {
+				_, err := ecdsa.GenerateKey(curve, rand.Reader)
+				return err
+			}},
+			{"Sign", func() error {
+				_, err := ecdsa.SignASN1(rand.Reader, priv, digest[:])
+				return err
+			}},
+			{"Verify", func() error {
+				if !ecdsa.VerifyASN1(&priv.PublicKey, digest[:], sig) {
+					return errors.New("invalid signature")
+				}
+				return nil
+			}},
+		},
+	}, nil
+}
+
+// PrimitiveResult is the cost of one operation of a KEM or signature
+// scheme, with the sizes it puts on the wire. OutputSize is the ciphertext
+// of a KEM or the signature; ECDSA signatures vary by a few bytes.
+type PrimitiveResult struct {
+	Primitive     string
+	Kind          string
+	Operation     string
+	PublicKeySize int
+	OutputSize    int
+	Summary       Summary
+}
+
+// MeasurePrimitives times n runs of every operation of every group and
+// authentication scheme, after one discarded run. The error of each
+// primitive that is not available is returned alongside the results.
+func MeasurePrimitives(n int) ([]PrimitiveResult, []error) {
+	ps, errs := primitives()
+
+	var results []PrimitiveResult
+	for _, p := range ps {
+		for _, op := range p.ops {
+			samples := make([]time.Duration, n)
+			err := op.run()
+			for i := 0; i < n && err == nil; i++ {
+				start := time.Now()
+				err = op.run()
+				samples[i] = time.Since(start)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s %s: %v", p.name, op.name, err))
+				continue
+			}
+			results = append(results, PrimitiveResult{
+				Primitive:     p.name,
+				Kind:          p.kind,
+				Operation:     op.name,
+				PublicKeySize: p.publicKeySize,
+				OutputSize:    p.outputSize,
+				Summary:       Summarize(samples),
+			})
+		}
+	}
+	return results, errs
+}
+
+// PrintPrimitives writes a table with the cost and sizes of every operation
+// in results to w.
+func PrintPrimitives(w io.Writer, results []PrimitiveResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Primitive\tKind\tOperation\tN\tMedian\tMean\tP95\tPublic key\tCiphertext/Signature\t")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%v\t%v\t%v\t%d\t%d\t\n",
+			r.Primitive, r.Kind, r.Operation, r.Summary.N, r.Summary.Median, r.Summary.Mean,
+			r.Summary.P95, r.PublicKeySize, r.OutputSize)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,31 @@
+package measure
+
+import "testing"
+
+// BenchmarkPrimitives times every operation of every group and
+// authentication scheme on its own, e.g.
+//
+//	go test -bench Primitives/Kyber512 ./measure
+//
+// The public key and ciphertext or signature sizes are reported as metrics.
+func BenchmarkPrimitives(b *testing.B) {
+	ps, errs := primitives()
+	for _, err := range errs {
+		b.Log(err)
+	}
+
+	for _, p := range ps {
+		for _, op := range p.ops {
+			p, op := p, op
+			b.Run(p.name+"/"+op.name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if err := op.run(); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(p.publicKeySize), "pk-bytes")
+				b.ReportMetric(float64(p.outputSize), "out-bytes")
+			})
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package measure
+
+import (
+	"fmt"
+	"io"
+)
+
+// PrintTimings writes the message ladder of the handshake of res, drawn from
+// the events of both peers, and the total time of each to w.
+func PrintTimings(w io.Writer, res Result) {
+	writeLadder(w, Diagram(res))
+
+	fmt.Fprintf(w, "Client Total time: %v \n", res.Timing.ClientTimingInfo.FullProtocol)
+	fmt.Fprintf(w, "Server Total time: %v \n", res.Timing.ServerTimingInfo.FullProtocol)
+}
+
+// PrintVerification prints the time each peer spent validating the other's
+// certificate chain.
+func PrintVerification(w io.Writer, v Verification) {
+	fmt.Fprintf(w, "Client chain validation: %v \n", v.Client)
+	if v.Server > 0 {
+		fmt.Fprintf(w, "Server chain validation: %v \n", v.Server)
+	}
+}
@@ -0,0 +1,45 @@
+package measure
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+)
+
+// Profile runs f while recording a CPU profile, and writes it and a heap
+// profile taken once f returned to dir, as name.cpu.pprof and
+// name.heap.pprof. The allocations in a heap profile accumulate over the
+// lifetime of the process: the ones of f alone are the difference with the
+// previous profile, e.g. with go tool pprof -base.
+func Profile(dir, name string, f func()) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	cpu, err := os.Create(filepath.Join(dir, name+".cpu.pprof"))
+	if err != nil {
+		return err
+	}
+	if err := pprof.StartCPUProfile(cpu); err != nil {
+		cpu.Close()
+		return err
+	}
+	f()
+	pprof.StopCPUProfile()
+	if err := cpu.Close(); err != nil {
+		return err
+	}
+
+	heap, err := os.Create(filepath.Join(dir, name+".heap.pprof"))
+	if err != nil {
+		return err
+	}
+	// Collect the garbage so that the in-use figures are up to date.
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(heap); err != nil {
+		heap.Close()
+		return err
+	}
+	return heap.Close()
+}
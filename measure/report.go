@@ -0,0 +1,364 @@
+package measure
+
+import (
+	"crypto/tls"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The layout of the report charts, in pixels.
+const (
+	chartWidth  = 760
+	chartHeight = 240
+	chartMargin = 50
+	barHeight   = 18
+	histBins    = 20
+)
+
+// chartColors are cycled through for the series of a chart.
+var chartColors = []string{
+	"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f", "#edc948",
+	"#b07aa1", "#ff9da7", "#9c755f", "#bab0ac", "#86bcb6", "#d37295",
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>KEMTLS measurements</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+svg { display: block; margin-bottom: 2em; }
+</style>
+</head>
+<body>
+<h1>KEMTLS measurements</h1>
+<p>Generated {{.Generated}}.</p>
+
+<h2>Scenarios</h2>
+<table>
+<tr><th>Scenario</th><th>Handshakes</th><th>OK</th><th>Latency median</th><th>Latency p95</th><th>Client median</th><th>Server median</th><th>Error</th></tr>
+{{range .Scenarios}}<tr><td>{{.Name}}</td><td>{{.N}}</td><td>{{.OK}}</td><td>{{.Latency.Median}}</td><td>{{.Latency.P95}}</td><td>{{.Client.Median}}</td><td>{{.Server.Median}}</td><td>{{.Err}}</td></tr>
+{{end}}</table>
+
+<h2>Negotiated parameters</h2>
+<table>
+<tr><th>Scenario</th>{{range .ParamNames}}<th>{{.}}</th>{{end}}</tr>
+{{range .Scenarios}}<tr><td>{{.Name}}</td>{{range .Params}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+
+<h2>Handshake latency</h2>
+<p>Distribution of the client's time from dialing until the handshake completed.</p>
+{{.CDF}}
+{{range .Scenarios}}<h3>{{.Name}}</h3>
+{{.Histogram}}
+{{end}}
+
+<h2>Time per step</h2>
+<p>Mean time each step took on each side, from the end of the previous step of the same side.</p>
+{{.Steps}}
+
+<h2>Bytes on the wire</h2>
+<table>
+<tr><th>Scenario</th><th>Side</th><th>Total</th><th>Records</th>{{range .Messages}}<th>{{.}}</th>{{end}}</tr>
+{{range .Scenarios}}{{$name := .Name}}{{range .Wire}}<tr><td>{{$name}}</td><td>{{.Side}}</td><td>{{.Bytes}}</td><td>{{.Records}}</td>{{range .Sizes}}<td>{{.}}</td>{{end}}</tr>
+{{end}}{{end}}</table>
+</body>
+</html>
+`))
+
+// reportScenario is what the report shows about one scenario.
+type reportScenario struct {
+	Name      string
+	N, OK     int
+	Latency   Summary
+	Client    Summary
+	Server    Summary
+	Err       string
+	Params    []string
+	Histogram template.HTML
+	Wire      []reportWire
+}
+
+type reportWire struct {
+	Side           string
+	Bytes, Records int
+	Sizes          []int
+}
+
+var reportParamNames = []string{"Version", "Cipher suite", "KEMTLS", "PQTLS", "Delegated credential", "Client authentication"}
+
+// WriteReport writes a single HTML page describing every scenario of sweep
+// to w: latency distributions, the mean time per step, the bytes written
+// and the negotiated parameters. The charts are inline SVG, so the page
+// needs nothing else to be viewed.
+func WriteReport(w io.Writer, sweep []SweepResult) error {
+	latency, _ := LookupStep(ClientSide, "HandshakeLatency")
+	clientFull, _ := LookupStep(ClientSide, "FullProtocol")
+	serverFull, _ := LookupStep(ServerSide, "FullProtocol")
+
+	data := struct {
+		Generated  string
+		Scenarios  []reportScenario
+		ParamNames []string
+		Messages   []string
+		CDF        template.HTML
+		Steps      template.HTML
+	}{
+		Generated:  time.Now().Format(time.RFC1123),
+		ParamNames: reportParamNames,
+		Messages:   reportMessages(),
+		CDF:        cdfChart(sweep, latency),
+		Steps:      stepChart(sweep),
+	}
+
+	for _, sr := range sweep {
+		rs := reportScenario{
+			Name:      sr.Scenario.String(),
+			N:         len(sr.Results),
+			Latency:   Summarize(StepSamples(latency, sr.Results)),
+			Client:    Summarize(StepSamples(clientFull, sr.Results)),
+			Server:    Summarize(StepSamples(serverFull, sr.Results)),
+			Histogram: histogram(StepSamples(latency, sr.Results)),
+		}
+		for _, res := range sr.Results {
+			if sr.Scenario.Succeeded(res) {
+				rs.OK++
+			}
+		}
+		if sr.Err != nil {
+			rs.Err = sr.Err.Error()
+		}
+		if len(sr.Results) > 0 {
+			res := sr.Results[len(sr.Results)-1]
+			rs.Params = negotiated(res)
+			for _, side := range []struct {
+				name string
+				f    FlightStats
+			}{{ClientSide, res.Wire.Client}, {ServerSide, res.Wire.Server}} {
+				rw := reportWire{Side: side.name, Bytes: side.f.Bytes, Records: side.f.Records}
+				for _, m := range data.Messages {
+					rw.Sizes = append(rw.Sizes, side.f.MessageSize(m))
+				}
+				rs.Wire = append(rs.Wire, rw)
+			}
+		}
+		data.Scenarios = append(data.Scenarios, rs)
+	}
+
+	return reportTemplate.Execute(w, data)
+}
+
+// reportMessages returns the columns of the wire table: WireMessages with
+// the second ClientHello after the HelloRetryRequest.
+func reportMessages() []string {
+	var msgs []string
+	for _, m := range WireMessages {
+		msgs = append(msgs, m)
+		if m == "HelloRetryRequest" {
+			msgs = append(msgs, secondClientHello)
+		}
+	}
+	return msgs
+}
+
+// negotiated returns the values of reportParamNames for res.
+func negotiated(res Result) []string {
+	cs := res.ClientState
+	version := fmt.Sprintf("0x%04x", cs.Version)
+	if cs.Version == tls.VersionTLS13 {
+		version = "TLS 1.3"
+	}
+	return []string{
+		version,
+		tls.CipherSuiteName(cs.CipherSuite),
+		fmt.Sprint(res.KEMTLSUsed),
+		fmt.Sprint(res.PQTLSUsed),
+		fmt.Sprint(res.DCUsed),
+		fmt.Sprint(res.ServerState.DidClientAuthentication),
+	}
+}
+
+// svgText escapes s for use in SVG markup.
+func svgText(s string) string {
+	return template.HTMLEscapeString(s)
+}
+
+// cdfChart draws the cumulative distribution of st in every scenario of
+// sweep, one line each.
+func cdfChart(sweep []SweepResult, st Step) template.HTML {
+	var max time.Duration
+	for _, sr := range sweep {
+		for _, d := range StepSamples(st, sr.Results) {
+			if d > max {
+				max = d
+			}
+		}
+	}
+	if max == 0 {
+		return ""
+	}
+
+	legend := 20 * len(sweep)
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-size="11">`, chartWidth, chartHeight+legend)
+	plotW, plotH := chartWidth-2*chartMargin, chartHeight-2*chartMargin
+	writeAxes(&b, max, plotW, plotH)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">1</text>`, chartMargin-4, chartMargin+4)
+
+	for i, sr := range sweep {
+		samples := StepSamples(st, sr.Results)
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+		color := chartColors[i%len(chartColors)]
+
+		var points []string
+		for j, d := range samples {
+			x := chartMargin + int(float64(plotW)*float64(d)/float64(max))
+			y := chartMargin + plotH - plotH*(j+1)/len(samples)
+			points = append(points, fmt.Sprintf("%d,%d", x, y))
+		}
+		fmt.Fprintf(&b, `<polyline fill="none" stroke="%s" stroke-width="2" points="%s"/>`, color, strings.Join(points, " "))
+
+		y := chartHeight + 20*i
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="12" height="12" fill="%s"/>`, chartMargin, y, color)
+		fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`, chartMargin+18, y+10, svgText(sr.Scenario.String()))
+	}
+	b.WriteString("</svg>")
+	return template.HTML(b.String())
+}
+
+// histogram draws the distribution of samples in histBins bins.
+func histogram(samples []time.Duration) template.HTML {
+	sum := Summarize(samples)
+	if sum.Max == 0 {
+		return ""
+	}
+
+	width := sum.Max - sum.Min
+	counts := make([]int, histBins)
+	most := 0
+	for _, d := range samples {
+		bin := histBins - 1
+		if width > 0 && d < sum.Max {
+			bin = int(int64(histBins) * int64(d-sum.Min) / int64(width))
+		}
+		counts[bin]++
+		if counts[bin] > most {
+			most = counts[bin]
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-size="11">`, chartWidth, chartHeight)
+	plotW, plotH := chartWidth-2*chartMargin, chartHeight-2*chartMargin
+	binW := plotW / histBins
+	for i, n := range counts {
+		h := plotH * n / most
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`,
+			chartMargin+i*binW, chartMargin+plotH-h, binW-1, h, chartColors[0])
+	}
+	fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black"/>`, chartMargin, chartMargin+plotH, chartMargin+plotW, chartMargin+plotH)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="start">%v</text>`, chartMargin, chartMargin+plotH+16, sum.Min)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%v</text>`, chartMargin+plotW, chartMargin+plotH+16, sum.Max)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%d</text>`, chartMargin-4, chartMargin+4, most)
+	b.WriteString("</svg>")
+	return template.HTML(b.String())
+}
+
+// writeAxes draws the axes of a plot from 0 to max, with five ticks.
+func writeAxes(b *strings.Builder, max time.Duration, plotW, plotH int) {
+	x0, y0 := chartMargin, chartMargin+plotH
+	fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black"/>`, x0, y0, x0+plotW, y0)
+	fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black"/>`, x0, y0, x0, chartMargin)
+	for i := 0; i <= 5; i++ {
+		x := x0 + plotW*i/5
+		tick := (max * time.Duration(i) / 5).Round(time.Microsecond)
+		fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black"/>`, x, y0, x, y0+4)
+		fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="middle">%v</text>`, x, y0+16, tick)
+	}
+}
+
+// stepChart draws, for each scenario of sweep and each side, a bar made of
+// the mean time of every step.
+func stepChart(sweep []SweepResult) template.HTML {
+	type bar struct {
+		label string
+		steps []string
+		means map[string]time.Duration
+		total time.Duration
+	}
+	var bars []bar
+	colors := map[string]string{}
+	var names []string
+	var max time.Duration
+
+	for _, sr := range sweep {
+		for _, side := range []string{ClientSide, ServerSide} {
+			b := bar{label: sr.Scenario.String() + ", " + side, means: map[string]time.Duration{}}
+			for _, res := range sr.Results {
+				for _, e := range Timeline(res.Events) {
+					if e.Side != side {
+						continue
+					}
+					if _, ok := b.means[e.Step]; !ok {
+						b.steps = append(b.steps, e.Step)
+					}
+					b.means[e.Step] += e.Took / time.Duration(len(sr.Results))
+				}
+			}
+			for _, name := range b.steps {
+				b.total += b.means[name]
+				if _, ok := colors[name]; !ok {
+					colors[name] = chartColors[len(colors)%len(chartColors)]
+					names = append(names, name)
+				}
+			}
+			if b.total > max {
+				max = b.total
+			}
+			bars = append(bars, b)
+		}
+	}
+	if max == 0 {
+		return ""
+	}
+
+	rowH := barHeight + 22
+	legend := 20 * ((len(names) + 3) / 4)
+	height := chartMargin + rowH*len(bars) + chartMargin + legend
+	plotW := chartWidth - 2*chartMargin
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-size="11">`, chartWidth, height)
+	for i, br := range bars {
+		y := chartMargin + rowH*i
+		fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`, chartMargin, y-4, svgText(br.label))
+		x := chartMargin
+		for _, name := range br.steps {
+			w := int(float64(plotW) * float64(br.means[name]) / float64(max))
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"><title>%s: %v</title></rect>`,
+				x, y, w, barHeight, colors[name], svgText(name), br.means[name])
+			x += w
+		}
+		fmt.Fprintf(&b, `<text x="%d" y="%d">%v</text>`, x+4, y+barHeight-4, br.total)
+	}
+
+	top := chartMargin + rowH*len(bars)
+	plotH := top - chartMargin
+	writeAxes(&b, max, plotW, plotH-rowH+barHeight)
+	for i, name := range names {
+		x := chartMargin + (plotW/4)*(i%4)
+		y := top + chartMargin/2 + 20*(i/4)
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="12" height="12" fill="%s"/>`, x, y, colors[name])
+		fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`, x+18, y+10, svgText(name))
+	}
+	b.WriteString("</svg>")
+	return template.HTML(b.String())
+}
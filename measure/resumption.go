@@ -0,0 +1,125 @@
+package measure
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// Resumption selects whether the measured handshakes resume a session.
+type Resumption int
+
+const (
+	// NoResumption measures full handshakes.
+	NoResumption Resumption = iota
+	// PSKDHE resumes with psk_dhe_ke: the ticket's PSK together with a fresh
+	// key exchange in the client's groups.
+	PSKDHE
+	// PSKOnly resumes with psk_ke, the ticket's PSK alone. crypto/tls only
+	// implements psk_dhe_ke, so CheckResumption rejects it.
+	PSKOnly
+)
+
+var resumptionNames = []string{
+	NoResumption: "none",
+	PSKDHE:       "psk_dhe_ke",
+	PSKOnly:      "psk_ke",
+}
+
+func (r Resumption) String() string {
+	if int(r) < len(resumptionNames) {
+		return resumptionNames[r]
+	}
+	return fmt.Sprintf("Resumption(%d)", int(r))
+}
+
+// ParseResumption returns the resumption mode with the given name.
+func ParseResumption(name string) (Resumption, error) {
+	for r, n := range resumptionNames {
+		if n == name {
+			return Resumption(r), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown resumption mode %q, want one of %s", name, strings.Join(resumptionNames, ", "))
+}
+
+// CheckResumption returns an error if r cannot be measured. crypto/tls only
+// resumes sessions with psk_dhe_ke.
+func CheckResumption(r Resumption) error {
+	switch r {
+	case NoResumption, PSKDHE:
+		return nil
+	case PSKOnly:
+		return errors.New("crypto/tls only resumes sessions with psk_dhe_ke, not psk_ke")
+	}
+	return fmt.Errorf("unknown resumption mode %v", r)
+}
+
+// resumptionField is the exported value of r, empty for full handshakes.
+func resumptionField(r Resumption) string {
+	if r == NoResumption {
+		return ""
+	}
+	return r.String()
+}
+
+// sessionCache keeps the last session ticket the client received, whatever
+// the server name, so that every handshake of a Session resumes the session
+// of the previous one.
+type sessionCache struct {
+	mu      sync.Mutex
+	session *tls.ClientSessionState
+}
+
+func (c *sessionCache) Get(string) (*tls.ClientSessionState, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.session, c.session != nil
+}
+
+// Put stores cs; crypto/tls puts nil to drop a session it could not resume.
+func (c *sessionCache) Put(_ string, cs *tls.ClientSessionState) {
+	c.mu.Lock()
+	c.session = cs
+	c.mu.Unlock()
+}
+
+// PrintResumptionComparison writes the handshake times, the bytes written
+// by each peer and the size of the session ticket of every scenario in
+// sweep to w, so that resumed handshakes can be compared with full ones.
+func PrintResumptionComparison(w io.Writer, sweep []SweepResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Protocol\tAuth\tGroup\tResumption\tOK\tClient median\tServer median\tClient bytes\tServer bytes\tTicket bytes\tError")
+	clientStep, _ := LookupStep(ClientSide, "FullProtocol")
+	serverStep, _ := LookupStep(ServerSide, "FullProtocol")
+	for _, sr := range sweep {
+		s := sr.Scenario
+		ok := 0
+		for _, res := range sr.Results {
+			if s.Succeeded(res) {
+				ok++
+			}
+		}
+
+		var clientBytes, serverBytes, ticketBytes int
+		if len(sr.Results) > 0 {
+			clientBytes = sr.Results[0].Wire.Client.Bytes
+			serverBytes = sr.Results[0].Wire.Server.Bytes
+			ticketBytes = sr.Results[0].Wire.Server.MessageSize("NewSessionTicket")
+		}
+
+		errStr := ""
+		if sr.Err != nil {
+			errStr = sr.Err.Error()
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%s\t%v\t%d/%d\t%v\t%v\t%d\t%d\t%d\t%s\n",
+			s.Protocol, s.Auth, curveList(s.ClientGroups, ","), s.Resumption, ok, len(sr.Results),
+			Summarize(StepSamples(clientStep, sr.Results)).Median, Summarize(StepSamples(serverStep, sr.Results)).Median,
+			clientBytes, serverBytes, ticketBytes, errStr)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,124 @@
+package measure
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// Summary describes the distribution of a set of duration samples. CILow and
+// CIHigh bound the 95% confidence interval of the mean.
+type Summary struct {
+	N      int
+	Min    time.Duration
+	Max    time.Duration
+	Mean   time.Duration
+	Median time.Duration
+	StdDev time.Duration
+	P90    time.Duration
+	P95    time.Duration
+	P99    time.Duration
+	CILow  time.Duration
+	CIHigh time.Duration
+}
+
+// tTable holds the two-sided 95% critical values of Student's t distribution
+// for 1 to 30 degrees of freedom; larger samples use the normal value.
+var tTable = [...]float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+func tCritical(df int) float64 {
+	if df >= 1 && df <= len(tTable) {
+		return tTable[df-1]
+	}
+	return 1.960
+}
+
+// Summarize computes the Summary of samples.
+func Summarize(samples []time.Duration) Summary {
+	sum := Summary{N: len(samples)}
+	if len(samples) == 0 {
+		return sum
+	}
+
+	sorted := make([]time.Duration, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total float64
+	for _, d := range sorted {
+		total += float64(d)
+	}
+	mean := total / float64(len(sorted))
+
+	var sq float64
+	for _, d := range sorted {
+		sq += (float64(d) - mean) * (float64(d) - mean)
+	}
+	var stddev, margin float64
+	if len(sorted) > 1 {
+		stddev = math.Sqrt(sq / float64(len(sorted)-1))
+		margin = tCritical(len(sorted)-1) * stddev / math.Sqrt(float64(len(sorted)))
+	}
+
+	sum.Min = sorted[0]
+	sum.Max = sorted[len(sorted)-1]
+	sum.Mean = time.Duration(mean)
+	sum.Median = percentile(sorted, 50)
+	sum.StdDev = time.Duration(stddev)
+	sum.P90 = percentile(sorted, 90)
+	sum.P95 = percentile(sorted, 95)
+	sum.P99 = percentile(sorted, 99)
+	sum.CILow = time.Duration(mean - margin)
+	sum.CIHigh = time.Duration(mean + margin)
+
+	return sum
+}
+
+// percentile returns the p-th percentile of sorted, interpolating linearly
+// between the closest ranks.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	frac := rank - float64(lo)
+	return sorted[lo] + time.Duration(frac*float64(sorted[hi]-sorted[lo]))
+}
+
+// StepSamples returns the duration of st in each of results.
+func StepSamples(st Step, results []Result) []time.Duration {
+	samples := make([]time.Duration, len(results))
+	for i, res := range results {
+		samples[i] = st.Duration(res)
+	}
+	return samples
+}
+
+// PrintSummary writes a table with the Summary of every step that took
+// place in results to w. Steps the protocol does not perform are omitted.
+func PrintSummary(w io.Writer, s Scenario, results []Result) {
+	fmt.Fprintf(w, "%v: %d handshakes\n", s, len(results))
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Side\tStep\tMin\tMax\tMean\tMedian\tStdDev\tP90\tP95\tP99\t95% CI\t")
+	for _, st := range Steps {
+		samples := StepSamples(st, results)
+		sum := Summarize(samples)
+		if sum.Max == 0 {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t[%v, %v]\t\n",
+			st.Side, st.Name, sum.Min, sum.Max, sum.Mean, sum.Median, sum.StdDev,
+			sum.P90, sum.P95, sum.P99, sum.CILow, sum.CIHigh)
+	}
+	tw.Flush()
+}
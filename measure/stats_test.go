@@ -0,0 +1,112 @@
+package measure
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	ms := time.Millisecond
+	for _, tt := range []struct {
+		sorted []time.Duration
+		p      float64
+		want   time.Duration
+	}{
+		{[]time.Duration{7 * ms}, 50, 7 * ms},
+		{[]time.Duration{7 * ms}, 99, 7 * ms},
+		{[]time.Duration{1 * ms, 2 * ms, 3 * ms, 4 * ms}, 0, 1 * ms},
+		{[]time.Duration{1 * ms, 2 * ms, 3 * ms, 4 * ms}, 100, 4 * ms},
+		{[]time.Duration{1 * ms, 2 * ms, 3 * ms, 4 * ms}, 50, 2500 * time.Microsecond},
+		{[]time.Duration{1 * ms, 2 * ms, 3 * ms, 4 * ms}, 90, 3700 * time.Microsecond},
+		{[]time.Duration{1 * ms, 2 * ms, 3 * ms}, 50, 2 * ms},
+		{[]time.Duration{0, 10 * ms}, 95, 9500 * time.Microsecond},
+	} {
+		if got := percentile(tt.sorted, tt.p); got != tt.want {
+			t.Errorf("percentile(%v, %v) = %v, want %v", tt.sorted, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestTCritical(t *testing.T) {
+	for _, tt := range []struct {
+		df   int
+		want float64
+	}{
+		{0, 1.960},
+		{1, 12.706},
+		{10, 2.228},
+		{30, 2.042},
+		{31, 1.960},
+	} {
+		if got := tCritical(tt.df); got != tt.want {
+			t.Errorf("tCritical(%d) = %v, want %v", tt.df, got, tt.want)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	ms := time.Millisecond
+	us := time.Microsecond
+	for _, tt := range []struct {
+		name    string
+		samples []time.Duration
+		want    Summary
+	}{
+		{"empty", nil, Summary{}},
+		{
+			"single",
+			[]time.Duration{5 * ms},
+			Summary{N: 1, Min: 5 * ms, Max: 5 * ms, Mean: 5 * ms, Median: 5 * ms,
+				P90: 5 * ms, P95: 5 * ms, P99: 5 * ms, CILow: 5 * ms, CIHigh: 5 * ms},
+		},
+		{
+			// The standard deviation is sqrt(5/3) ms and the CI margin
+			// 3.182 times it over sqrt(4).
+			"unsorted",
+			[]time.Duration{4 * ms, 1 * ms, 3 * ms, 2 * ms},
+			Summary{N: 4, Min: 1 * ms, Max: 4 * ms, Mean: 2500 * us, Median: 2500 * us,
+				StdDev: 1290994, P90: 3700 * us, P95: 3850 * us, P99: 3970 * us,
+				CILow: 446027, CIHigh: 4553972},
+		},
+		{
+			"constant",
+			[]time.Duration{2 * ms, 2 * ms, 2 * ms},
+			Summary{N: 3, Min: 2 * ms, Max: 2 * ms, Mean: 2 * ms, Median: 2 * ms,
+				P90: 2 * ms, P95: 2 * ms, P99: 2 * ms, CILow: 2 * ms, CIHigh: 2 * ms},
+		},
+	} {
+		got := Summarize(tt.samples)
+		// Floating-point rounding may move the derived values by a
+		// nanosecond.
+		for _, f := range []struct {
+			name      string
+			got, want time.Duration
+		}{
+			{"Min", got.Min, tt.want.Min},
+			{"Max", got.Max, tt.want.Max},
+			{"Mean", got.Mean, tt.want.Mean},
+			{"Median", got.Median, tt.want.Median},
+			{"StdDev", got.StdDev, tt.want.StdDev},
+			{"P90", got.P90, tt.want.P90},
+			{"P95", got.P95, tt.want.P95},
+			{"P99", got.P99, tt.want.P99},
+			{"CILow", got.CILow, tt.want.CILow},
+			{"CIHigh", got.CIHigh, tt.want.CIHigh},
+		} {
+			if d := f.got - f.want; d < -1 || d > 1 {
+				t.Errorf("%s: %s = %v, want %v", tt.name, f.name, f.got, f.want)
+			}
+		}
+		if got.N != tt.want.N {
+			t.Errorf("%s: N = %d, want %d", tt.name, got.N, tt.want.N)
+		}
+	}
+}
+
+func TestSummarizeKeepsSamples(t *testing.T) {
+	samples := []time.Duration{3, 1, 2}
+	Summarize(samples)
+	if samples[0] != 3 || samples[1] != 1 || samples[2] != 2 {
+		t.Errorf("Summarize reordered its input to %v", samples)
+	}
+}
@@ -0,0 +1,85 @@
+package measure
+
+import "time"
+
+const (
+	ClientSide = "client"
+	ServerSide = "server"
+)
+
+// Step is one timed phase of the handshake as reported by one of the peers.
+type Step struct {
+	Side string
+	Name string
+	get  func(Result) time.Duration
+}
+
+// Duration returns the time the step took in res.
+func (st Step) Duration(res Result) time.Duration {
+	return st.get(res)
+}
+
+// timingSteps lists every field of the client and server timing events but
+// FullProtocol, in handshake order. Each is the time since the side started
+// its handshake, zero if the step did not happen.
+var timingSteps = []Step{
+	{ClientSide, "WriteClientHello", func(res Result) time.Duration { return res.Timing.ClientTimingInfo.WriteClientHello }},
+	{ClientSide, "ProcessServerHello", func(res Result) time.Duration { return res.Timing.ClientTimingInfo.ProcessServerHello }},
+	{ClientSide, "ReadEncryptedExtensions", func(res Result) time.Duration { return res.Timing.ClientTimingInfo.ReadEncryptedExtensions }},
+	{ClientSide, "ReadCertificate", func(res Result) time.Duration { return res.Timing.ClientTimingInfo.ReadCertificate }},
+	{ClientSide, "ReadCertificateVerify", func(res Result) time.Duration { return res.Timing.ClientTimingInfo.ReadCertificateVerify }},
+	{ClientSide, "WriteKEMCiphertext", func(res Result) time.Duration { return res.Timing.ClientTimingInfo.WriteKEMCiphertext }},
+	{ClientSide, "WriteCertificate", func(res Result) time.Duration { return res.Timing.ClientTimingInfo.WriteCertificate }},
+	{ClientSide, "WriteCertificateVerify", func(res Result) time.Duration { return res.Timing.ClientTimingInfo.WriteCertificateVerify }},
+	{ClientSide, "ReadKEMCiphertext", func(res Result) time.Duration { return res.Timing.ClientTimingInfo.ReadKEMCiphertext }},
+	{ClientSide, "WriteClientFinished", func(res Result) time.Duration { return res.Timing.ClientTimingInfo.WriteClientFinished }},
+	{ClientSide, "ReadServerFinished", func(res Result) time.Duration { return res.Timing.ClientTimingInfo.ReadServerFinished }},
+
+	{ServerSide, "ProcessClientHello", func(res Result) time.Duration { return res.Timing.ServerTimingInfo.ProcessClientHello }},
+	{ServerSide, "WriteServerHello", func(res Result) time.Duration { return res.Timing.ServerTimingInfo.WriteServerHello }},
+	{ServerSide, "WriteEncryptedExtensions", func(res Result) time.Duration { return res.Timing.ServerTimingInfo.WriteEncryptedExtensions }},
+	{ServerSide, "WriteCertificate", func(res Result) time.Duration { return res.Timing.ServerTimingInfo.WriteCertificate }},
+	{ServerSide, "WriteCertificateVerify", func(res Result) time.Duration { return res.Timing.ServerTimingInfo.WriteCertificateVerify }},
+	{ServerSide, "ReadKEMCiphertext", func(res Result) time.Duration { return res.Timing.ServerTimingInfo.ReadKEMCiphertext }},
+	{ServerSide, "ReadCertificate", func(res Result) time.Duration { return res.Timing.ServerTimingInfo.ReadCertificate }},
+	{ServerSide, "ReadCertificateVerify", func(res Result) time.Duration { return res.Timing.ServerTimingInfo.ReadCertificateVerify }},
+	{ServerSide, "WriteKEMCiphertext", func(res Result) time.Duration { return res.Timing.ServerTimingInfo.WriteKEMCiphertext }},
+	{ServerSide, "ReadClientFinished", func(res Result) time.Duration { return res.Timing.ServerTimingInfo.ReadClientFinished }},
+	{ServerSide, "WriteServerFinished", func(res Result) time.Duration { return res.Timing.ServerTimingInfo.WriteServerFinished }},
+}
+
+// Steps lists the timingSteps followed by the chain validation of each side
+// (also counted in the step reading the peer's certificate), the CPU time of
+// each side, FullProtocol for each side, the client's wall-clock Latency,
+// when each side read the first and last byte of application data, since
+// dialing, and when the client wrote its first, since dialing and since the
+// server wrote its Finished.
+var Steps = append(timingSteps[:len(timingSteps):len(timingSteps)], []Step{
+	{ClientSide, "VerifyChain", func(res Result) time.Duration { return res.Verification.Client }},
+	{ServerSide, "VerifyChain", func(res Result) time.Duration { return res.Verification.Server }},
+
+	{ClientSide, "CPUTime", func(res Result) time.Duration { return res.CPU.Client.Total() }},
+	{ServerSide, "CPUTime", func(res Result) time.Duration { return res.CPU.Server.Total() }},
+
+	{ClientSide, "FullProtocol", func(res Result) time.Duration { return res.Timing.ClientTimingInfo.FullProtocol }},
+	{ServerSide, "FullProtocol", func(res Result) time.Duration { return res.Timing.ServerTimingInfo.FullProtocol }},
+
+	{ClientSide, "HandshakeLatency", func(res Result) time.Duration { return res.Latency.Handshake }},
+	{ClientSide, "TimeToFirstByte", func(res Result) time.Duration { return res.Latency.FirstByte }},
+	{ServerSide, "TimeToFirstByte", func(res Result) time.Duration { return res.App.Server.FirstByte }},
+	{ClientSide, "TimeToLastByte", func(res Result) time.Duration { return res.App.Client.LastByte }},
+	{ServerSide, "TimeToLastByte", func(res Result) time.Duration { return res.App.Server.LastByte }},
+
+	{ClientSide, "TimeToFirstWrite", func(res Result) time.Duration { return res.Latency.ClientData }},
+	{ClientSide, "FirstWriteAfterServerFinished", func(res Result) time.Duration { return res.ClientDataAfterServerFinished() }},
+}...)
+
+// LookupStep returns the step of side with the given name.
+func LookupStep(side, name string) (Step, bool) {
+	for _, st := range Steps {
+		if st.Side == side && st.Name == name {
+			return st, true
+		}
+	}
+	return Step{}, false
+}
@@ -0,0 +1,247 @@
+package measure
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Matrix is a set of protocol families, authentication modes and algorithms
+// to measure against each other.
+type Matrix struct {
+	Protocols []Protocol
+	Auths     []AuthMode
+	Groups    []tls.CurveID
+	Schemes   []tls.SignatureScheme
+
+	// Links are the networks each combination is measured over. No links
+	// means the loopback connection alone.
+	Links []Link
+
+	// Chains are the certificate chains each combination is measured with.
+	// No chains means the default one.
+	Chains []Chain
+
+	// CertDir is where every scenario loads its certificates from.
+	CertDir string
+
+	// Workload is exchanged after every handshake.
+	Workload Workload
+
+	// Memory measures the allocations of every scenario.
+	Memory bool
+
+	// Resumptions are the resumption modes each combination is measured
+	// with. No resumptions means full handshakes alone.
+	Resumptions []Resumption
+
+	// Mispredict also measures every combination with a client that
+	// predicts the wrong group, see clientGroups.
+	Mispredict bool
+}
+
+// clientGroups returns the groups the client offers to a server that only
+// supports Groups[i]: that group alone and, if m.Mispredict, that group
+// after the next one of Groups. crypto/tls only sends a key share for the
+// first group it offers, so the latter has to retry after a
+// HelloRetryRequest. Clients sending several or all of their shares cannot
+// be run: the client's makeClientHello builds keyShares from
+// curvePreferences()[0] alone, and Config has no setting to change that;
+// PrintKeyShareStrategies computes their ClientHellos instead.
+func (m Matrix) clientGroups(i int) [][]tls.CurveID {
+	g := m.Groups[i]
+	lists := [][]tls.CurveID{{g}}
+	if m.Mispredict && len(m.Groups) > 1 {
+		wrong := m.Groups[(i+1)%len(m.Groups)]
+		lists = append(lists, []tls.CurveID{wrong, g})
+	}
+	return lists
+}
+
+// Scenarios returns the valid scenarios in the cross product of m. Both
+// peers offer a single group and, for mutual authentication, use the same
+// scheme for their delegated credentials.
+func (m Matrix) Scenarios() []Scenario {
+	links := m.Links
+	if len(links) == 0 {
+		links = []Link{{}}
+	}
+	chains := m.Chains
+	if len(chains) == 0 {
+		chains = []Chain{{}}
+	}
+	resumptions := m.Resumptions
+	if len(resumptions) == 0 {
+		resumptions = []Resumption{NoResumption}
+	}
+
+	var scenarios []Scenario
+	for _, p := range m.Protocols {
+		for _, a := range m.Auths {
+			for i, g := range m.Groups {
+				for _, clientGroups := range m.clientGroups(i) {
+					for _, scheme := range m.Schemes {
+						for _, chain := range chains {
+							for _, link := range links {
+								for _, r := range resumptions {
+									s := Scenario{
+										Protocol:     p,
+										Auth:         a,
+										ServerGroups: []tls.CurveID{g},
+										ClientGroups: clientGroups,
+										ServerScheme: scheme,
+										Link:         link,
+										CertDir:      m.CertDir,
+										Chain:        chain,
+										Workload:     m.Workload,
+										Memory:       m.Memory,
+										Resumption:   r,
+									}
+									if a == MutualAuth {
+										s.ClientScheme = scheme
+									}
+									if s.Validate() == nil {
+										scenarios = append(scenarios, s)
+									}
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return scenarios
+}
+
+// SweepResult holds the handshakes measured for one scenario of a sweep.
+type SweepResult struct {
+	Scenario Scenario
+	Results  []Result
+	Err      error
+}
+
+// Sweep measures n handshakes, after warmup discarded ones, of every
+// scenario. A failing scenario is recorded and does not stop the sweep.
+func Sweep(scenarios []Scenario, warmup, n int) []SweepResult {
+	sweep := make([]SweepResult, len(scenarios))
+	for i, s := range scenarios {
+		results, err := Repeat(s, warmup, n)
+		sweep[i] = SweepResult{Scenario: s, Results: results, Err: err}
+	}
+	return sweep
+}
+
+// PrintComparison writes a table comparing the full handshake time and the
+// bytes written by each peer of every scenario in sweep to w.
+func PrintComparison(w io.Writer, sweep []SweepResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Protocol\tAuth\tGroup\tScheme\tLoss\tOK\tClient median\tClient p95\tServer median\tServer p95\tClient bytes\tServer bytes\tError")
+	clientStep, _ := LookupStep(ClientSide, "FullProtocol")
+	serverStep, _ := LookupStep(ServerSide, "FullProtocol")
+	for _, sr := range sweep {
+		s := sr.Scenario
+		ok := 0
+		for _, res := range sr.Results {
+			if s.Succeeded(res) {
+				ok++
+			}
+		}
+
+		client := Summarize(StepSamples(clientStep, sr.Results))
+		server := Summarize(StepSamples(serverStep, sr.Results))
+
+		var clientBytes, serverBytes int
+		if len(sr.Results) > 0 {
+			clientBytes = sr.Results[0].Wire.Client.Bytes
+			serverBytes = sr.Results[0].Wire.Server.Bytes
+		}
+
+		errStr := ""
+		if sr.Err != nil {
+			errStr = sr.Err.Error()
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%s\t%s\t%.3g%%\t%d/%d\t%v\t%v\t%v\t%v\t%d\t%d\t%s\n",
+			s.Protocol, s.Auth, curveList(s.ClientGroups, ","), SchemeName(s.ServerScheme),
+			100*s.Link.Loss.Rate(), ok, len(sr.Results), client.Median, client.P95, server.Median, server.P95,
+			clientBytes, serverBytes, errStr)
+	}
+	tw.Flush()
+}
+
+// PrintLatencyDistribution writes the distribution of the handshake
+// completion time and the time to first byte, as seen by the client, of
+// every scenario in sweep to w, so that each loss rate can be compared.
+func PrintLatencyDistribution(w io.Writer, sweep []SweepResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Protocol\tAuth\tGroup\tScheme\tLoss\tStep\tN\tMin\tMedian\tP90\tP99\tMax\t")
+	for _, sr := range sweep {
+		s := sr.Scenario
+		for _, name := range []string{"HandshakeLatency", "TimeToFirstByte"} {
+			st, _ := LookupStep(ClientSide, name)
+			sum := Summarize(StepSamples(st, sr.Results))
+			fmt.Fprintf(tw, "%v\t%v\t%s\t%s\t%.3g%%\t%s\t%d\t%v\t%v\t%v\t%v\t%v\t\n",
+				s.Protocol, s.Auth, curveList(s.ClientGroups, ","), SchemeName(s.ServerScheme),
+				100*s.Link.Loss.Rate(), st.Name, sum.N, sum.Min, sum.Median, sum.P90, sum.P99, sum.Max)
+		}
+	}
+	tw.Flush()
+}
+
+// PrintChainComparison writes the size of the server's Certificate message
+// and the time the client took to validate the chain in every scenario of
+// sweep to w.
+func PrintChainComparison(w io.Writer, sweep []SweepResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Protocol\tAuth\tScheme\tChain\tCertificate bytes\tVerify median\tVerify p95\tClient median")
+	verifyStep, _ := LookupStep(ClientSide, "VerifyChain")
+	clientStep, _ := LookupStep(ClientSide, "FullProtocol")
+	for _, sr := range sweep {
+		s := sr.Scenario
+		certBytes := 0
+		if len(sr.Results) > 0 {
+			certBytes = sr.Results[0].Wire.Server.MessageSize("Certificate")
+		}
+		verify := Summarize(StepSamples(verifyStep, sr.Results))
+		client := Summarize(StepSamples(clientStep, sr.Results))
+		fmt.Fprintf(tw, "%v\t%v\t%s\t%v\t%d\t%v\t%v\t%v\n",
+			s.Protocol, s.Auth, SchemeName(s.ServerScheme), s.Chain,
+			certBytes, verify.Median, verify.P95, client.Median)
+	}
+	tw.Flush()
+}
+
+// PrintKeyShareComparison writes, for every scenario in sweep, the groups
+// each peer supports, whether the server sent a HelloRetryRequest, the size
+// of each of the client's ClientHellos and the round trips they took, and
+// the handshake times, so that a mispredicted key share can be priced.
+func PrintKeyShareComparison(w io.Writer, sweep []SweepResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Protocol\tAuth\tClient groups\tServer groups\tHRR\tClientHello bytes\tClientHello2 bytes\tRound trips\tClient median\tLatency median\tError")
+	clientStep, _ := LookupStep(ClientSide, "FullProtocol")
+	latencyStep, _ := LookupStep(ClientSide, "HandshakeLatency")
+	for _, sr := range sweep {
+		s := sr.Scenario
+		var hrr bool
+		var helloBytes, retryBytes, roundTrips int
+		if len(sr.Results) > 0 {
+			ws := sr.Results[0].Wire
+			hrr = ws.Server.MessageCount("HelloRetryRequest") > 0
+			helloBytes = ws.Client.MessageSize("ClientHello")
+			retryBytes = ws.Client.MessageSize(secondClientHello)
+			// Every ClientHello waits for a ServerHello or a HelloRetryRequest.
+			roundTrips = ws.Client.MessageCount("ClientHello") + ws.Client.MessageCount(secondClientHello)
+		}
+
+		errStr := ""
+		if sr.Err != nil {
+			errStr = sr.Err.Error()
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%s\t%s\t%v\t%d\t%d\t%d\t%v\t%v\t%s\n",
+			s.Protocol, s.Auth, curveList(s.ClientGroups, ","), curveList(s.ServerGroups, ","), hrr,
+			helloBytes, retryBytes, roundTrips, Summarize(StepSamples(clientStep, sr.Results)).Median,
+			Summarize(StepSamples(latencyStep, sr.Results)).Median, errStr)
+	}
+	tw.Flush()
+}
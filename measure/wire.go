@@ -0,0 +1,373 @@
+package measure
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	recordHeaderLen = 5
+	maxPlaintext    = 16384
+
+	recordTypeChangeCipherSpec = 20
+	recordTypeHandshake        = 22
+	recordTypeApplicationData  = 23
+
+	// aeadOverhead is the inner content type and the 16 byte tag that every
+	// TLS 1.3 AEAD adds to an encrypted record.
+	aeadOverhead = 1 + 16
+
+	// encryptedMessage names an encrypted handshake message that has not been
+	// matched to the protocol's flight yet.
+	encryptedMessage = "Encrypted"
+
+	// secondClientHello names the ClientHello a client sends in answer to a
+	// HelloRetryRequest, ClientHello2 in RFC 8446, Section 4.4.1, so that it
+	// is not counted with the first one.
+	secondClientHello = "ClientHello2"
+)
+
+var handshakeTypeNames = map[byte]string{
+	1:  "ClientHello",
+	2:  "ServerHello",
+	4:  "NewSessionTicket",
+	8:  "EncryptedExtensions",
+	11: "Certificate",
+	13: "CertificateRequest",
+	15: "CertificateVerify",
+	20: "Finished",
+}
+
+// helloRetryRequestRandom is the ServerHello.random value that marks a
+// HelloRetryRequest, see RFC 8446, Section 4.1.3.
+var helloRetryRequestRandom = []byte{
+	0xCF, 0x21, 0xAD, 0x74, 0xE5, 0x9A, 0x61, 0x11,
+	0xBE, 0x1D, 0x8C, 0x02, 0x1E, 0x65, 0xB8, 0x91,
+	0xC2, 0xA2, 0x11, 0x16, 0x7A, 0xBB, 0x8C, 0x5E,
+	0x07, 0x9E, 0x09, 0xE2, 0xC8, 0xA8, 0x33, 0x9C,
+}
+
+// WireMessages lists the handshake messages whose sizes are reported. The
+// second ClientHello, reported as ClientHello2, is exported after every
+// other column.
+var WireMessages = []string{
+	"ClientHello",
+	"HelloRetryRequest",
+	"ServerHello",
+	"EncryptedExtensions",
+	"CertificateRequest",
+	"Certificate",
+	"CertificateVerify",
+	"KEMCiphertext",
+	"Finished",
+	"NewSessionTicket",
+}
+
+// MessageSize is the size of a handshake message, including its four byte
+// header but not the record layer.
+type MessageSize struct {
+	Name string
+	Size int
+}
+
+// FlightStats counts what one peer wrote on the wire during its handshake.
+type FlightStats struct {
+	// Bytes and Records include the record headers, the encryption overhead
+	// and the ChangeCipherSpec records sent for middlebox compatibility.
+	Bytes    int
+	Records  int
+	Messages []MessageSize
+}
+
+// MessageSize returns the total size of the messages with the given name.
+func (f FlightStats) MessageSize(name string) int {
+	size := 0
+	for _, m := range f.Messages {
+		if m.Name == name {
+			size += m.Size
+		}
+	}
+	return size
+}
+
+// MessageCount returns the number of messages with the given name.
+func (f FlightStats) MessageCount(name string) int {
+	count := 0
+	for _, m := range f.Messages {
+		if m.Name == name {
+			count++
+		}
+	}
+	return count
+}
+
+// WireStats is what each peer wrote during the handshake.
+type WireStats struct {
+	Client FlightStats
+	Server FlightStats
+}
+
+// label names the encrypted handshake messages after the flights of s.
+// Encrypted records are opaque, so the names follow the order in which the
+// protocol sends its messages; any extra record keeps the Encrypted name.
+//
+// No specification fixes the flights of KEMTLS-PDK with client
+// authentication, so they are taken from the timing events t instead, and
+// the records are only named if there are exactly as many as the events
+// account for.
+func (ws *WireStats) label(s Scenario, t TimingInfo) {
+	if s.Protocol == KEMTLSPDK && s.Auth == MutualAuth && s.Resumption == NoResumption {
+		server := timedMessages(t, ServerSide)
+		// The client only sends its certificate when asked to, and the
+		// CertificateRequest follows the EncryptedExtensions, see RFC 8446,
+		// Section 4.3.2.
+		if t.ClientTimingInfo.WriteCertificate != 0 && len(server) > 0 && server[0] == "EncryptedExtensions" {
+			server = append([]string{server[0], "CertificateRequest"}, server[1:]...)
+		}
+		labelWholeFlight(ws.Client.Messages, timedMessages(t, ClientSide))
+		labelWholeFlight(ws.Server.Messages, server)
+		return
+	}
+	labelFlight(ws.Client.Messages, expectedMessages(s, ClientSide))
+	labelFlight(ws.Server.Messages, expectedMessages(s, ServerSide))
+}
+
+func labelFlight(msgs []MessageSize, names []string) {
+	for i := range msgs {
+		if msgs[i].Name != encryptedMessage {
+			continue
+		}
+		if len(names) == 0 {
+			return
+		}
+		msgs[i].Name, names = names[0], names[1:]
+	}
+}
+
+// labelWholeFlight names the encrypted messages in msgs after names if
+// there are as many, and leaves them Encrypted otherwise.
+func labelWholeFlight(msgs []MessageSize, names []string) {
+	encrypted := 0
+	for _, m := range msgs {
+		if m.Name == encryptedMessage {
+			encrypted++
+		}
+	}
+	if encrypted == len(names) {
+		labelFlight(msgs, names)
+	}
+}
+
+// timedMessages returns the encrypted handshake messages that the timing
+// events of t show side wrote, in the order it wrote them.
+func timedMessages(t TimingInfo, side string) []string {
+	res := Result{Timing: t}
+	var steps []Step
+	for _, st := range timingSteps {
+		msg := stepMessages[st.Name]
+		if st.Side != side || msg == "" || msg == "ClientHello" || msg == "ServerHello" || st.Duration(res) == 0 {
+			continue
+		}
+		steps = append(steps, st)
+	}
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].Duration(res) < steps[j].Duration(res) })
+
+	names := make([]string, len(steps))
+	for i, st := range steps {
+		names[i] = stepMessages[st.Name]
+	}
+	return names
+}
+
+// expectedMessages returns the encrypted handshake messages side sends in
+// scenario s, in order. KEMTLS-PDK with client authentication is labelled
+// from the timing events instead, see WireStats.label.
+func expectedMessages(s Scenario, side string) []string {
+	mutual := s.Auth == MutualAuth
+	switch {
+	case s.Resumption != NoResumption && side == ServerSide:
+		return []string{"EncryptedExtensions", "Finished", "NewSessionTicket"}
+	case s.Resumption != NoResumption:
+		return []string{"Finished"}
+	case s.Protocol == KEMTLSPDK && side == ServerSide:
+		return []string{"EncryptedExtensions", "Finished"}
+	case s.Protocol == KEMTLSPDK:
+		return []string{"Finished"}
+	case s.Protocol == KEMTLS && side == ServerSide && mutual:
+		return []string{"EncryptedExtensions", "CertificateRequest", "Certificate", "KEMCiphertext", "Finished"}
+	case s.Protocol == KEMTLS && side == ServerSide:
+		return []string{"EncryptedExtensions", "Certificate", "Finished"}
+	case s.Protocol == KEMTLS && mutual:
+		return []string{"KEMCiphertext", "Certificate", "Finished"}
+	case s.Protocol == KEMTLS:
+		return []string{"KEMCiphertext", "Finished"}
+	case side == ServerSide && mutual:
+		return []string{"EncryptedExtensions", "CertificateRequest", "Certificate", "CertificateVerify", "Finished", "NewSessionTicket"}
+	case side == ServerSide:
+		return []string{"EncryptedExtensions", "Certificate", "CertificateVerify", "Finished", "NewSessionTicket"}
+	case mutual:
+		return []string{"Certificate", "CertificateVerify", "Finished"}
+	}
+	return []string{"Finished"}
+}
+
+// recordingConn is a net.Conn that parses the TLS records written through it
+// and counts them.
+type recordingConn struct {
+	net.Conn
+
+	mu      sync.Mutex
+	pending []byte // written bytes not forming a full record yet
+	hs      []byte // plaintext handshake bytes not forming a full message yet
+	stats   FlightStats
+
+	// handshakeDone is set once the peer's handshake returned, and
+	// firstData is when the first encrypted record was written after it.
+	handshakeDone bool
+	firstData     time.Time
+}
+
+func newRecordingConn(c net.Conn) *recordingConn {
+	return &recordingConn{Conn: c}
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	c.pending = append(c.pending, b...)
+	c.parseRecords()
+	c.mu.Unlock()
+
+	return c.Conn.Write(b)
+}
+
+func (c *recordingConn) parseRecords() {
+	for len(c.pending) >= recordHeaderLen {
+		typ := c.pending[0]
+		n := int(c.pending[3])<<8 | int(c.pending[4])
+		if len(c.pending) < recordHeaderLen+n {
+			return
+		}
+		payload := c.pending[recordHeaderLen : recordHeaderLen+n]
+
+		c.stats.Bytes += recordHeaderLen + n
+		c.stats.Records++
+
+		switch typ {
+		case recordTypeHandshake:
+			c.hs = append(c.hs, payload...)
+			c.parseHandshake()
+		case recordTypeApplicationData:
+			if c.handshakeDone && c.firstData.IsZero() {
+				c.firstData = time.Now()
+			}
+			c.addEncrypted(n - aeadOverhead)
+		}
+
+		c.pending = c.pending[recordHeaderLen+n:]
+	}
+}
+
+// parseHandshake splits the plaintext handshake messages.
+func (c *recordingConn) parseHandshake() {
+	for len(c.hs) >= 4 {
+		n := int(c.hs[1])<<16 | int(c.hs[2])<<8 | int(c.hs[3])
+		if len(c.hs) < 4+n {
+			return
+		}
+		msg := c.hs[:4+n]
+
+		name, ok := handshakeTypeNames[msg[0]]
+		if !ok {
+			name = fmt.Sprintf("HandshakeType(%d)", msg[0])
+		}
+		// legacy_version is followed by the random.
+		if name == "ServerHello" && len(msg) >= 6+32 && bytes.Equal(msg[6:6+32], helloRetryRequestRandom) {
+			name = "HelloRetryRequest"
+		}
+		if name == "ClientHello" && c.stats.MessageCount("ClientHello") > 0 {
+			name = secondClientHello
+		}
+		c.stats.Messages = append(c.stats.Messages, MessageSize{name, len(msg)})
+
+		c.hs = c.hs[4+n:]
+	}
+}
+
+// addEncrypted records an encrypted record of n plaintext bytes. crypto/tls
+// writes every handshake message in its own records, so a full record
+// continues in the next one. The encryption hides where a message ends, so a
+// message of exactly a multiple of maxPlaintext bytes is merged with the one
+// after it, and the messages after them are labelled one name early. Only
+// a certificate chain can grow that large, and it would have to match the
+// record size to the byte.
+func (c *recordingConn) addEncrypted(n int) {
+	msgs := c.stats.Messages
+	if last := len(msgs) - 1; last >= 0 && msgs[last].Name == encryptedMessage && msgs[last].Size%maxPlaintext == 0 {
+		msgs[last].Size += n
+		return
+	}
+	c.stats.Messages = append(msgs, MessageSize{encryptedMessage, n})
+}
+
+// handshakeOver marks the end of the peer's handshake, after which the
+// encrypted records carry application data.
+func (c *recordingConn) handshakeOver() {
+	c.mu.Lock()
+	c.handshakeDone = true
+	c.mu.Unlock()
+}
+
+// firstDataAt returns when the first application data record was written,
+// zero if none was.
+func (c *recordingConn) firstDataAt() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.firstData
+}
+
+// flight returns a copy of what has been written so far.
+func (c *recordingConn) flight() FlightStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f := c.stats
+	f.Messages = append([]MessageSize(nil), c.stats.Messages...)
+	return f
+}
+
+// dial runs the client side of the handshake on conn like tls.Dial does
+// for host, recording what the client writes and, if m is not nil, metering
+// its allocations.
+func dial(conn net.Conn, host string, config *tls.Config, m *memMeter) (*tls.Conn, *recordingConn, error) {
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName = host
+	}
+
+	rc := newRecordingConn(conn)
+	client := tls.Client(metered(rc, m), config)
+	if err := client.Handshake(); err != nil {
+		rc.Close()
+		return nil, nil, err
+	}
+	return client, rc, nil
+}
+
+// PrintWire writes the bytes, records and handshake message sizes of ws to w.
+func PrintWire(w io.Writer, ws WireStats) {
+	for _, side := range []struct {
+		name string
+		f    FlightStats
+	}{{"Client", ws.Client}, {"Server", ws.Server}} {
+		fmt.Fprintf(w, "%s wrote %d bytes in %d records\n", side.name, side.f.Bytes, side.f.Records)
+		for _, m := range side.f.Messages {
+			fmt.Fprintf(w, "   %-20s %6d bytes\n", m.Name, m.Size)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package measure
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// tlsRecord returns a TLS record of type typ carrying payload.
+func tlsRecord(typ byte, payload []byte) []byte {
+	return append([]byte{typ, 3, 3, byte(len(payload) >> 8), byte(len(payload))}, payload...)
+}
+
+// handshakeMessage returns a handshake message of type typ with a body of n
+// bytes, filled with fill.
+func handshakeMessage(typ byte, n int, fill byte) []byte {
+	return append([]byte{typ, byte(n >> 16), byte(n >> 8), byte(n)}, bytes.Repeat([]byte{fill}, n)...)
+}
+
+// discardConn is a net.Conn whose writes succeed and go nowhere.
+type discardConn struct{ net.Conn }
+
+func (discardConn) Write(b []byte) (int, error) { return len(b), nil }
+
+func TestRecordingConn(t *testing.T) {
+	serverHello := handshakeMessage(2, 60, 0)
+	hrr := handshakeMessage(2, 60, 0)
+	copy(hrr[6:], helloRetryRequestRandom)
+	twoMessages := append(handshakeMessage(1, 10, 0), handshakeMessage(4, 6, 0)...)
+	split := handshakeMessage(11, 30, 0)
+
+	for _, tt := range []struct {
+		name    string
+		writes  [][]byte
+		bytes   int
+		records int
+		msgs    []MessageSize
+	}{
+		{
+			name:    "plaintext messages",
+			writes:  [][]byte{tlsRecord(recordTypeHandshake, serverHello)},
+			bytes:   5 + 64,
+			records: 1,
+			msgs:    []MessageSize{{"ServerHello", 64}},
+		},
+		{
+			name:    "hello retry request",
+			writes:  [][]byte{tlsRecord(recordTypeHandshake, hrr)},
+			bytes:   5 + 64,
+			records: 1,
+			msgs:    []MessageSize{{"HelloRetryRequest", 64}},
+		},
+		{
+			name:    "two messages in a record",
+			writes:  [][]byte{tlsRecord(recordTypeHandshake, twoMessages)},
+			bytes:   5 + 24,
+			records: 1,
+			msgs:    []MessageSize{{"ClientHello", 14}, {"NewSessionTicket", 10}},
+		},
+		{
+			name: "second client hello",
+			writes: [][]byte{
+				tlsRecord(recordTypeHandshake, handshakeMessage(1, 200, 0)),
+				tlsRecord(recordTypeChangeCipherSpec, []byte{1}),
+				tlsRecord(recordTypeHandshake, handshakeMessage(1, 230, 0)),
+			},
+			bytes:   5 + 204 + 6 + 5 + 234,
+			records: 3,
+			msgs:    []MessageSize{{"ClientHello", 204}, {secondClientHello, 234}},
+		},
+		{
+			name: "message split across records",
+			writes: [][]byte{
+				tlsRecord(recordTypeHandshake, split[:20]),
+				tlsRecord(recordTypeHandshake, split[20:]),
+			},
+			bytes:   5 + 20 + 5 + 14,
+			records: 2,
+			msgs:    []MessageSize{{"Certificate", 34}},
+		},
+		{
+			name: "record split across writes",
+			writes: func() [][]byte {
+				r := tlsRecord(recordTypeHandshake, serverHello)
+				return [][]byte{r[:3], r[3:40], r[40:]}
+			}(),
+			bytes:   5 + 64,
+			records: 1,
+			msgs:    []MessageSize{{"ServerHello", 64}},
+		},
+		{
+			name: "change cipher spec",
+			writes: [][]byte{
+				tlsRecord(recordTypeChangeCipherSpec, []byte{1}),
+			},
+			bytes:   6,
+			records: 1,
+		},
+		{
+			name: "unknown handshake type",
+			writes: [][]byte{
+				tlsRecord(recordTypeHandshake, handshakeMessage(24, 2, 0)),
+			},
+			bytes:   5 + 6,
+			records: 1,
+			msgs:    []MessageSize{{"HandshakeType(24)", 6}},
+		},
+		{
+			// Encrypted records lose the AEAD overhead.
+			name: "encrypted records",
+			writes: [][]byte{
+				tlsRecord(recordTypeApplicationData, make([]byte, 100+aeadOverhead)),
+				tlsRecord(recordTypeApplicationData, make([]byte, 36+aeadOverhead)),
+			},
+			bytes:   2*5 + 136 + 2*aeadOverhead,
+			records: 2,
+			msgs:    []MessageSize{{encryptedMessage, 100}, {encryptedMessage, 36}},
+		},
+		{
+			// A full record continues in the next one.
+			name: "encrypted message over full records",
+			writes: [][]byte{
+				tlsRecord(recordTypeApplicationData, make([]byte, maxPlaintext+aeadOverhead)),
+				tlsRecord(recordTypeApplicationData, make([]byte, maxPlaintext+aeadOverhead)),
+				tlsRecord(recordTypeApplicationData, make([]byte, 500+aeadOverhead)),
+				tlsRecord(recordTypeApplicationData, make([]byte, 36+aeadOverhead)),
+			},
+			bytes:   4*5 + 2*maxPlaintext + 536 + 4*aeadOverhead,
+			records: 4,
+			msgs:    []MessageSize{{encryptedMessage, 2*maxPlaintext + 500}, {encryptedMessage, 36}},
+		},
+		{
+			// The end of a message filling its records is not visible, so
+			// the next message is taken for its continuation.
+			name: "encrypted message of exactly a full record",
+			writes: [][]byte{
+				tlsRecord(recordTypeApplicationData, make([]byte, maxPlaintext+aeadOverhead)),
+				tlsRecord(recordTypeApplicationData, make([]byte, 36+aeadOverhead)),
+			},
+			bytes:   2*5 + maxPlaintext + 36 + 2*aeadOverhead,
+			records: 2,
+			msgs:    []MessageSize{{encryptedMessage, maxPlaintext + 36}},
+		},
+		{
+			// Only encrypted messages are merged.
+			name: "plaintext message before a full record",
+			writes: [][]byte{
+				tlsRecord(recordTypeHandshake, handshakeMessage(2, maxPlaintext-4, 0)),
+				tlsRecord(recordTypeApplicationData, make([]byte, 10+aeadOverhead)),
+			},
+			bytes:   2*5 + maxPlaintext + 10 + aeadOverhead,
+			records: 2,
+			msgs:    []MessageSize{{"ServerHello", maxPlaintext}, {encryptedMessage, 10}},
+		},
+	} {
+		c := newRecordingConn(discardConn{})
+		for _, w := range tt.writes {
+			if _, err := c.Write(w); err != nil {
+				t.Fatal(err)
+			}
+		}
+		f := c.flight()
+		if f.Bytes != tt.bytes || f.Records != tt.records {
+			t.Errorf("%s: %d bytes in %d records, want %d in %d", tt.name, f.Bytes, f.Records, tt.bytes, tt.records)
+		}
+		if !reflect.DeepEqual(f.Messages, tt.msgs) {
+			t.Errorf("%s: messages %v, want %v", tt.name, f.Messages, tt.msgs)
+		}
+	}
+}
+
+func TestRecordingConnIncompleteRecord(t *testing.T) {
+	c := newRecordingConn(discardConn{})
+	r := tlsRecord(recordTypeHandshake, handshakeMessage(1, 10, 0))
+	c.Write(r[:len(r)-1])
+	if f := c.flight(); f.Bytes != 0 || f.Records != 0 || len(f.Messages) != 0 {
+		t.Errorf("incomplete record counted: %+v", f)
+	}
+	c.Write(r[len(r)-1:])
+	if f := c.flight(); f.Bytes != len(r) || f.Records != 1 {
+		t.Errorf("completed record: %+v, want %d bytes in 1 record", f, len(r))
+	}
+}
+
+func TestRecordingConnFirstData(t *testing.T) {
+	c := newRecordingConn(discardConn{})
+	c.Write(tlsRecord(recordTypeApplicationData, make([]byte, 36+aeadOverhead)))
+	if at := c.firstDataAt(); !at.IsZero() {
+		t.Errorf("handshake record taken for application data at %v", at)
+	}
+
+	c.handshakeOver()
+	before := time.Now()
+	c.Write(tlsRecord(recordTypeApplicationData, make([]byte, 100+aeadOverhead)))
+	first := c.firstDataAt()
+	if first.Before(before) {
+		t.Errorf("first application data at %v, before it was written at %v", first, before)
+	}
+	c.Write(tlsRecord(recordTypeApplicationData, make([]byte, 100+aeadOverhead)))
+	if at := c.firstDataAt(); !at.Equal(first) {
+		t.Errorf("first application data moved from %v to %v", first, at)
+	}
+}
+
+func TestLabelFlight(t *testing.T) {
+	msgs := []MessageSize{
+		{"ServerHello", 90},
+		{encryptedMessage, 6},
+		{encryptedMessage, 1200},
+		{encryptedMessage, 36},
+		{encryptedMessage, 20},
+	}
+	labelFlight(msgs, []string{"EncryptedExtensions", "Certificate", "Finished"})
+	want := []MessageSize{
+		{"ServerHello", 90},
+		{"EncryptedExtensions", 6},
+		{"Certificate", 1200},
+		{"Finished", 36},
+		{encryptedMessage, 20},
+	}
+	if !reflect.DeepEqual(msgs, want) {
+		t.Errorf("labelFlight = %v, want %v", msgs, want)
+	}
+}
+
+func TestLabelPDKMutual(t *testing.T) {
+	s := DefaultScenario(KEMTLSPDK, MutualAuth)
+	encrypted := func(hello string, n int) []MessageSize {
+		msgs := []MessageSize{{hello, 300}}
+		for i := 0; i < n; i++ {
+			msgs = append(msgs, MessageSize{encryptedMessage, 10 * (i + 1)})
+		}
+		return msgs
+	}
+	names := func(msgs []MessageSize) []string {
+		var names []string
+		for _, m := range msgs[1:] {
+			names = append(names, m.Name)
+		}
+		return names
+	}
+	timing := TimingInfo{
+		ClientTimingInfo: tls.CFEventTLS13ClientHandshakeTimingInfo{
+			WriteClientHello:    1,
+			WriteCertificate:    5,
+			WriteClientFinished: 6,
+		},
+		ServerTimingInfo: tls.CFEventTLS13ServerHandshakeTimingInfo{
+			WriteServerHello:         2,
+			WriteEncryptedExtensions: 3,
+			WriteKEMCiphertext:       7,
+			WriteServerFinished:      8,
+		},
+	}
+
+	for _, tt := range []struct {
+		name                   string
+		timing                 TimingInfo
+		client, server         int
+		wantClient, wantServer []string
+	}{
+		{
+			"events",
+			timing, 2, 4,
+			[]string{"Certificate", "Finished"},
+			[]string{"EncryptedExtensions", "CertificateRequest", "KEMCiphertext", "Finished"},
+		},
+		{
+			// An extra record makes every position a guess.
+			"extra record",
+			timing, 3, 5,
+			[]string{encryptedMessage, encryptedMessage, encryptedMessage},
+			[]string{encryptedMessage, encryptedMessage, encryptedMessage, encryptedMessage, encryptedMessage},
+		},
+		{
+			"no events",
+			TimingInfo{}, 2, 4,
+			[]string{encryptedMessage, encryptedMessage},
+			[]string{encryptedMessage, encryptedMessage, encryptedMessage, encryptedMessage},
+		},
+	} {
+		ws := WireStats{
+			Client: FlightStats{Messages: encrypted("ClientHello", tt.client)},
+			Server: FlightStats{Messages: encrypted("ServerHello", tt.server)},
+		}
+		ws.label(s, tt.timing)
+		if got := names(ws.Client.Messages); !reflect.DeepEqual(got, tt.wantClient) {
+			t.Errorf("%s: client messages %v, want %v", tt.name, got, tt.wantClient)
+		}
+		if got := names(ws.Server.Messages); !reflect.DeepEqual(got, tt.wantServer) {
+			t.Errorf("%s: server messages %v, want %v", tt.name, got, tt.wantServer)
+		}
+	}
+}
+
+func TestFlightStatsMessageSize(t *testing.T) {
+	f := FlightStats{Messages: []MessageSize{{"ClientHello", 300}, {"Finished", 36}, {"ClientHello", 320}}}
+	if got := f.MessageSize("ClientHello"); got != 620 {
+		t.Errorf("MessageSize(ClientHello) = %d, want 620", got)
+	}
+	if got := f.MessageCount("ClientHello"); got != 2 {
+		t.Errorf("MessageCount(ClientHello) = %d, want 2", got)
+	}
+	if got := f.MessageSize("Certificate"); got != 0 {
+		t.Errorf("MessageSize(Certificate) = %d, want 0", got)
+	}
+}
@@ -0,0 +1,257 @@
+package measure
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Workload modes.
+const (
+	PingPong = "pingpong"
+	Stream   = "stream"
+	Echo     = "echo"
+)
+
+// Workload is the application data the peers exchange once their handshake
+// is done. The client starts writing as soon as its side of the handshake
+// is over, which KEMTLS allows before the server's Finished; see
+// Result.ClientDataAfterServerFinished.
+type Workload struct {
+	// Mode is one of:
+	//  - PingPong, the default: the client sends Size bytes and the server
+	//    answers with Size bytes, RoundTrips times.
+	//  - Stream: the client sends Size bytes, which the server acknowledges
+	//    with a single byte once it read them all.
+	//  - Echo: the server sends the client's Size bytes back as they arrive.
+	Mode string
+
+	// Size is the length of the test messages if zero.
+	Size int
+
+	// RoundTrips is 1 if zero.
+	RoundTrips int
+}
+
+// ParseWorkloadMode checks that name is a workload mode.
+func ParseWorkloadMode(name string) (string, error) {
+	switch name {
+	case "", PingPong:
+		return PingPong, nil
+	case Stream, Echo:
+		return name, nil
+	}
+	return "", fmt.Errorf("unknown workload %q, want %s, %s or %s", name, PingPong, Stream, Echo)
+}
+
+func (w Workload) mode() string {
+	if w.Mode == "" {
+		return PingPong
+	}
+	return w.Mode
+}
+
+func (w Workload) size() int {
+	if w.Size == 0 {
+		return len(clientMsg)
+	}
+	return w.Size
+}
+
+func (w Workload) roundTrips() int {
+	if w.RoundTrips == 0 || w.mode() != PingPong {
+		return 1
+	}
+	return w.RoundTrips
+}
+
+func (w Workload) isZero() bool {
+	return w == Workload{}
+}
+
+func (w Workload) String() string {
+	str := fmt.Sprintf("%s of %d bytes", w.mode(), w.size())
+	if w.roundTrips() > 1 {
+		str += fmt.Sprintf(" ×%d", w.roundTrips())
+	}
+	return str
+}
+
+// AppStats is the application data one peer read after its handshake. The
+// times are since dialing, so that both sides and every protocol family
+// share the same origin.
+type AppStats struct {
+	Bytes     int
+	FirstByte time.Duration
+	LastByte  time.Duration
+
+	// firstRead is the number of bytes of the read at FirstByte.
+	firstRead int
+}
+
+// Goodput returns the application bits read per second from the first to
+// the last application byte, leaving out the handshake and the bytes of the
+// first read, which arrived before the interval started. It is zero if all
+// the bytes came in a single read.
+func (a AppStats) Goodput() float64 {
+	if a.LastByte <= a.FirstByte {
+		return 0
+	}
+	return float64(8*(a.Bytes-a.firstRead)) / (a.LastByte - a.FirstByte).Seconds()
+}
+
+// AppUsage holds the AppStats of each peer.
+type AppUsage struct {
+	Client AppStats
+	Server AppStats
+}
+
+// appReader records the application data read through it.
+type appReader struct {
+	r     io.Reader
+	start time.Time
+	stats *AppStats
+}
+
+func (r appReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	if n > 0 {
+		at := time.Since(r.start)
+		if r.stats.Bytes == 0 {
+			r.stats.FirstByte = at
+			r.stats.firstRead = n
+		}
+		r.stats.Bytes += n
+		r.stats.LastByte = at
+	}
+	return n, err
+}
+
+// payload returns n bytes repeating msg.
+func payload(msg string, n int) []byte {
+	return []byte(strings.Repeat(msg, n/len(msg)+1)[:n])
+}
+
+// readPayload reads len(want) bytes from r and checks they are want.
+func readPayload(side string, r io.Reader, want []byte) error {
+	got := make([]byte, len(want))
+	if n, err := io.ReadFull(r, got); err != nil {
+		return fmt.Errorf("%s read %d of %d bytes: %v", side, n, len(want), err)
+	}
+	if !bytes.Equal(got, want) {
+		return fmt.Errorf("%s read unexpected data %.32q, want %.32q", side, got, want)
+	}
+	return nil
+}
+
+// runClient runs the client side of w on conn, sending clientMsg and
+// expecting serverMsg, and records what it reads in stats. conn is closed
+// if the client fails while still writing.
+func (w Workload) runClient(conn io.ReadWriteCloser, clientMsg, serverMsg string, start time.Time, stats *AppStats) error {
+	r := appReader{conn, start, stats}
+	request := payload(clientMsg, w.size())
+
+	switch w.mode() {
+	case Stream:
+		if _, err := conn.Write(request); err != nil {
+			return err
+		}
+		return readPayload(ClientSide, r, []byte{streamAck})
+	case Echo:
+		// The server echoes while the client is still writing.
+		written := make(chan error, 1)
+		go func() {
+			_, err := conn.Write(request)
+			written <- err
+		}()
+		if err := readPayload(ClientSide, r, request); err != nil {
+			// Closing the connection makes a blocked write fail.
+			conn.Close()
+			<-written
+			return err
+		}
+		return <-written
+	}
+
+	response := payload(serverMsg, w.size())
+	for i := 0; i < w.roundTrips(); i++ {
+		if _, err := conn.Write(request); err != nil {
+			return err
+		}
+		if err := readPayload(ClientSide, r, response); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamAck is what the server answers a stream with.
+const streamAck = 'k'
+
+// runServer runs the server side of w on conn and records what it reads in
+// stats.
+func (w Workload) runServer(conn io.ReadWriter, clientMsg, serverMsg string, start time.Time, stats *AppStats) error {
+	r := appReader{conn, start, stats}
+	request := payload(clientMsg, w.size())
+
+	switch w.mode() {
+	case Stream:
+		if err := readPayload(ServerSide, r, request); err != nil {
+			return err
+		}
+		_, err := conn.Write([]byte{streamAck})
+		return err
+	case Echo:
+		_, err := io.CopyN(conn, r, int64(w.size()))
+		return err
+	}
+
+	response := payload(serverMsg, w.size())
+	for i := 0; i < w.roundTrips(); i++ {
+		if err := readPayload(ServerSide, r, request); err != nil {
+			return err
+		}
+		if _, err := conn.Write(response); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PrintApp writes the median times at which each peer read the first and
+// the last application byte, and its mean goodput, over results to w.
+func PrintApp(w io.Writer, results []Result) {
+	if len(results) == 0 {
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Side\tBytes read\tFirst byte\tLast byte\tGoodput (bit/s)\t")
+	for _, side := range []struct {
+		name string
+		get  func(Result) AppStats
+	}{
+		{ClientSide, func(res Result) AppStats { return res.App.Client }},
+		{ServerSide, func(res Result) AppStats { return res.App.Server }},
+	} {
+		var first, last []time.Duration
+		var goodput float64
+		for _, res := range results {
+			a := side.get(res)
+			first = append(first, a.FirstByte)
+			last = append(last, a.LastByte)
+			goodput += a.Goodput()
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%v\t%v\t%.0f\t\n", side.name, side.get(results[0]).Bytes,
+			Summarize(first).Median, Summarize(last).Median, goodput/float64(len(results)))
+	}
+	tw.Flush()
+
+	write, _ := LookupStep(ClientSide, "TimeToFirstWrite")
+	afterFinished, _ := LookupStep(ClientSide, "FirstWriteAfterServerFinished")
+	fmt.Fprintf(w, "Client first write: %v after dialing, %v after the server's Finished\n",
+		Summarize(StepSamples(write, results)).Median, Summarize(StepSamples(afterFinished, results)).Median)
+}
@@ -0,0 +1,57 @@
+package measure
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestGoodput(t *testing.T) {
+	ms := time.Millisecond
+	for _, tt := range []struct {
+		name string
+		a    AppStats
+		want float64
+	}{
+		{"nothing read", AppStats{}, 0},
+		{"single read", AppStats{Bytes: 1000, FirstByte: 5 * ms, LastByte: 5 * ms, firstRead: 1000}, 0},
+		// 1000 bytes after the first read of 500, in 4ms.
+		{"several reads", AppStats{Bytes: 1500, FirstByte: 5 * ms, LastByte: 9 * ms, firstRead: 500}, 2e6},
+	} {
+		if got := tt.a.Goodput(); got != tt.want {
+			t.Errorf("%s: Goodput() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// writeTrackingConn records whether a Write is still running.
+type writeTrackingConn struct {
+	net.Conn
+	writing chan struct{}
+}
+
+func (c writeTrackingConn) Write(b []byte) (int, error) {
+	c.writing <- struct{}{}
+	defer func() { <-c.writing }()
+	return c.Conn.Write(b)
+}
+
+func TestRunClientEchoFailure(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	w := Workload{Mode: Echo, Size: 100}
+
+	// The server answers with the wrong bytes and never reads, so the
+	// client's write blocks until runClient gives up on it.
+	go server.Write(bytes.Repeat([]byte{'x'}, w.Size))
+
+	conn := writeTrackingConn{client, make(chan struct{}, 1)}
+	var stats AppStats
+	if err := w.runClient(conn, clientMsg, serverMsg, time.Now(), &stats); err == nil {
+		t.Fatal("runClient succeeded on a wrong echo")
+	}
+	if len(conn.writing) != 0 {
+		t.Error("runClient returned while still writing")
+	}
+}
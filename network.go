@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strconv"
+
+	"github.com/claucece/KEMTLS-local-measurements/measure"
+)
+
+// networkFlags configure the network emulated between the peers.
+type networkFlags struct {
+	link      measure.Link
+	loss      string
+	lossModel string
+	burst     float64
+}
+
+func (nf *networkFlags) register(fs *flag.FlagSet) {
+	fs.DurationVar(&nf.link.Delay, "delay", 0, "emulated one-way delay, e.g. 25ms")
+	fs.DurationVar(&nf.link.Jitter, "jitter", 0, "maximum random variation of the one-way delay")
+	fs.Int64Var(&nf.link.Bandwidth, "bandwidth", 0, "emulated bandwidth per direction in bit/s, 0 for unlimited")
+	fs.IntVar(&nf.link.InitCwnd, "initcwnd", 0, "initial congestion window in segments, 0 to disable slow start")
+	fs.IntVar(&nf.link.MSS, "mss", 0, "segment size in bytes, 1460 if 0")
+	fs.StringVar(&nf.loss, "loss", "0", "comma-separated segment loss rates between 0 and 1, each measured separately")
+	fs.StringVar(&nf.lossModel, "loss-model", "uniform", "loss model: uniform or gilbert-elliott")
+	fs.Float64Var(&nf.burst, "burst", 3, "mean number of segments lost in a row with the gilbert-elliott model")
+	fs.DurationVar(&nf.link.RTO, "rto", 0, "initial retransmission timeout, 200ms plus the round trip if 0")
+}
+
+// links returns the emulated link for each loss rate.
+func (nf *networkFlags) links() []measure.Link {
+	var links []measure.Link
+	for _, s := range splitList(nf.loss) {
+		rate, err := strconv.ParseFloat(s, 64)
+		if err != nil || rate < 0 || rate >= 1 {
+			log.Fatalf("invalid loss rate %q, want a number in [0, 1)", s)
+		}
+
+		link := nf.link
+		switch nf.lossModel {
+		case "uniform":
+			link.Loss = measure.UniformLoss(rate)
+		case "gilbert-elliott":
+			link.Loss = measure.GilbertElliottLoss(rate, nf.burst)
+		default:
+			log.Fatalf("unknown loss model %q, want uniform or gilbert-elliott", nf.lossModel)
+		}
+		links = append(links, link)
+	}
+	if len(links) == 0 {
+		links = append(links, nf.link)
+	}
+	return links
+}
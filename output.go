@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/claucece/KEMTLS-local-measurements/measure"
+)
+
+// outputFlags are the repetition and export flags shared by the commands.
+type outputFlags struct {
+	iterations int
+	warmup     int
+	format     string
+	out        string
+	html       string
+}
+
+func (o *outputFlags) register(fs *flag.FlagSet, iterations int) {
+	fs.IntVar(&o.iterations, "n", iterations, "number of measured handshakes")
+	fs.IntVar(&o.warmup, "warmup", 0, "number of handshakes to run and discard before measuring")
+	fs.StringVar(&o.format, "format", "", "export every handshake as csv or jsonl")
+	fs.StringVar(&o.out, "o", "-", "file to export to with -format, - for stdout")
+	fs.StringVar(&o.html, "html", "", "file to write an HTML report of the results to")
+}
+
+// open returns where the human readable output goes and, if -format is set,
+// the exporter for the records and the file it writes to, if not stdout. The
+// human readable output moves to stderr when stdout carries the exported
+// records.
+func (o *outputFlags) open() (io.Writer, *measure.Exporter, io.Closer) {
+	if o.iterations < 1 {
+		log.Fatal("-n must be at least 1")
+	}
+	if o.format == "" {
+		return os.Stdout, nil, nil
+	}
+	if o.out == "-" {
+		exporter, err := measure.NewExporter(os.Stdout, o.format)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return os.Stderr, exporter, nil
+	}
+
+	f, err := os.Create(o.out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	exporter, err := measure.NewExporter(f, o.format)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return os.Stdout, exporter, f
+}
+
+// export writes results of s with exporter, if there is one.
+func export(exporter *measure.Exporter, s measure.Scenario, results []measure.Result) {
+	if exporter == nil {
+		return
+	}
+	for i, res := range results {
+		if err := exporter.Write(s, i, res); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// closeExporter flushes the exported records and closes f, if not nil.
+func closeExporter(exporter *measure.Exporter, f io.Closer) {
+	if exporter == nil {
+		return
+	}
+	if err := exporter.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	if f == nil {
+		return
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// report writes the HTML report of sweep, if -html is set.
+func (o *outputFlags) report(sweep []measure.SweepResult) {
+	if o.html == "" {
+		return
+	}
+	f, err := os.Create(o.html)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := measure.WriteReport(f, sweep); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/claucece/KEMTLS-local-measurements/measure"
+)
+
+// primitivesCommand times the KEM and signature operations behind every
+// group and authentication scheme, outside of any handshake.
+func primitivesCommand(args []string) {
+	fs := flag.NewFlagSet("primitives", flag.ExitOnError)
+	n := fs.Int("n", 100, "number of timed runs of each operation")
+	fs.Parse(args)
+	if *n < 1 {
+		log.Fatal("-n must be at least 1")
+	}
+
+	results, errs := measure.MeasurePrimitives(*n)
+	measure.PrintPrimitives(os.Stdout, results)
+	for _, err := range errs {
+		log.Println(err)
+	}
+}
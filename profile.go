@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/claucece/KEMTLS-local-measurements/measure"
+)
+
+// profileFlags select the memory measurements and the pprof profiles.
+type profileFlags struct {
+	memory bool
+	dir    string
+}
+
+func (pf *profileFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&pf.memory, "mem", false, "measure the allocations of each peer, running them in turn; the timings are then not representative")
+	fs.StringVar(&pf.dir, "profile", "", "directory to write a pprof CPU and heap profile of each scenario to")
+}
+
+// profile runs f, which measures s, the i-th scenario, and writes its
+// profiles if -profile is set.
+func (pf *profileFlags) profile(i int, s measure.Scenario, f func()) {
+	if pf.dir == "" {
+		f()
+		return
+	}
+	name := fmt.Sprintf("%03d-%v-%v", i, s.Protocol, s.Auth)
+	if s.ServerScheme != 0 {
+		name += "-" + measure.SchemeName(s.ServerScheme)
+	}
+	if err := measure.Profile(pf.dir, name, f); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// sweep is measure.Sweep, profiling every scenario separately.
+func (pf *profileFlags) sweep(scenarios []measure.Scenario, warmup, n int) []measure.SweepResult {
+	var sweep []measure.SweepResult
+	for i, s := range scenarios {
+		pf.profile(i, s, func() {
+			sweep = append(sweep, measure.Sweep([]measure.Scenario{s}, warmup, n)...)
+		})
+	}
+	return sweep
+}
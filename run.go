@@ -0,0 +1,167 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/claucece/KEMTLS-local-measurements/measure"
+)
+
+// runCommand measures one protocol family in one authentication mode.
+func runCommand(args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	protocolFlag := fs.String("protocol", "tls13", "protocol family: tls13, pqtls, kemtls or kemtls-pdk")
+	authFlag := fs.String("auth", "server-only", "authentication mode: server-only or mutual")
+	diagram := fs.String("diagram", "", "file to draw the last handshake to, as Mermaid (.mmd), PlantUML (.puml) or SVG (.svg)")
+	resumption := fs.String("resumption", "none", "resume the session of the previous handshake: none or psk_dhe_ke")
+	var certs certFlags
+	certs.register(fs)
+	var output outputFlags
+	output.register(fs, 1)
+	var network networkFlags
+	network.register(fs)
+	var prof profileFlags
+	prof.register(fs)
+	var work workloadFlags
+	work.register(fs)
+	fs.Parse(args)
+
+	protocol, err := measure.ParseProtocol(*protocolFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	auth, err := measure.ParseAuthMode(*authFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	r, err := measure.ParseResumption(*resumption)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := measure.CheckResumption(r); err != nil {
+		log.Fatal(err)
+	}
+
+	human, exporter, out := output.open()
+	s := measure.DefaultScenario(protocol, auth)
+	s.CertDir = certs.dir
+	s.Memory = prof.memory
+	s.Resumption = r
+	var exchange bool
+	s.Workload, exchange = work.workload()
+	links := network.links()
+	chains := certs.list()
+	if len(links) > 1 || len(chains) > 1 {
+		runVariants(s, chains, links, output, prof, human, exporter, out)
+		return
+	}
+	s.Chain = chains[0]
+	s.Link = links[0]
+
+	var results []measure.Result
+	if output.iterations == 1 && output.warmup == 0 {
+		var res measure.Result
+		prof.profile(0, s, func() { res, err = measure.Run(s) })
+		measure.PrintTimings(human, res)
+		measure.PrintVerification(human, res.Verification)
+		measure.PrintWire(human, res.Wire)
+		if err == nil {
+			results = append(results, res)
+			measure.PrintCPU(human, results)
+		}
+	} else {
+		prof.profile(0, s, func() { results, err = measure.Repeat(s, output.warmup, output.iterations) })
+		if len(results) > 0 {
+			measure.PrintSummary(human, s, results)
+			measure.PrintWire(human, results[len(results)-1].Wire)
+			measure.PrintCPU(human, results)
+		}
+	}
+	if exchange {
+		measure.PrintApp(human, results)
+	}
+	if s.Memory {
+		measure.PrintMemory(human, results)
+	}
+	if *diagram != "" && len(results) > 0 {
+		writeDiagram(*diagram, results[len(results)-1])
+	}
+
+	export(exporter, s, results)
+	closeExporter(exporter, out)
+	output.report([]measure.SweepResult{{Scenario: s, Results: results, Err: err}})
+
+	logOutcome(s, err, allSucceeded(s, results))
+}
+
+// runVariants measures s with each of chains over each of links and
+// compares the handshake completion times and, for several chains, their
+// sizes and validation times.
+func runVariants(s measure.Scenario, chains []measure.Chain, links []measure.Link, output outputFlags, prof profileFlags, human io.Writer, exporter *measure.Exporter, out io.Closer) {
+	var scenarios []measure.Scenario
+	for _, chain := range chains {
+		for _, link := range links {
+			v := s
+			v.Chain = chain
+			v.Link = link
+			scenarios = append(scenarios, v)
+		}
+	}
+
+	sweep := prof.sweep(scenarios, output.warmup, output.iterations)
+	for _, sr := range sweep {
+		export(exporter, sr.Scenario, sr.Results)
+	}
+	closeExporter(exporter, out)
+	output.report(sweep)
+
+	measure.PrintLatencyDistribution(human, sweep)
+	if len(chains) > 1 {
+		measure.PrintChainComparison(human, sweep)
+	}
+	if s.Memory {
+		measure.PrintMemoryComparison(human, sweep)
+	}
+	for _, sr := range sweep {
+		logOutcome(sr.Scenario, sr.Err, allSucceeded(sr.Scenario, sr.Results))
+	}
+}
+
+// diagramFormats maps the extensions of the diagram files to their format.
+var diagramFormats = map[string]string{
+	".mmd":  measure.DiagramMermaid,
+	".puml": measure.DiagramPlantUML,
+	".svg":  measure.DiagramSVG,
+}
+
+// writeDiagram draws the sequence diagram of res to name, in the format
+// given by its extension.
+func writeDiagram(name string, res measure.Result) {
+	format, ok := diagramFormats[filepath.Ext(name)]
+	if !ok {
+		log.Fatalf("%s: unknown diagram extension, want .mmd, .puml or .svg", name)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := measure.WriteDiagram(f, format, measure.Diagram(res)); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// allSucceeded reports whether results is not empty and s succeeded in
+// every one of them.
+func allSucceeded(s measure.Scenario, results []measure.Result) bool {
+	succeeded := len(results) > 0
+	for _, res := range results {
+		succeeded = succeeded && s.Succeeded(res)
+	}
+	return succeeded
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/claucece/KEMTLS-local-measurements/measure"
+)
+
+// sweepCommand measures every valid combination of the given protocol
+// families, authentication modes, groups and schemes.
+func sweepCommand(args []string) {
+	fs := flag.NewFlagSet("sweep", flag.ExitOnError)
+	protocols := fs.String("protocols", "tls13,pqtls,kemtls,kemtls-pdk", "comma-separated protocol families")
+	auths := fs.String("auth", "server-only", "comma-separated authentication modes")
+	groups := fs.String("groups", "X25519,SIKEp434,Kyber512", "comma-separated key exchange groups")
+	schemes := fs.String("schemes", "Ed25519,Ed448,PQTLSWithDilithium3,KEMTLSWithSIKEp434,KEMTLSWithKyber512", "comma-separated delegated credential schemes")
+	resumptions := fs.String("resumption", "none", "comma-separated resumption modes: none or psk_dhe_ke")
+	mispredict := fs.Bool("mispredict", false, "also measure clients sending a key share for the next group, forcing a HelloRetryRequest")
+	var certs certFlags
+	certs.register(fs)
+	var output outputFlags
+	output.register(fs, 10)
+	var network networkFlags
+	network.register(fs)
+	var prof profileFlags
+	prof.register(fs)
+	var work workloadFlags
+	work.register(fs)
+	fs.Parse(args)
+
+	m := measure.Matrix{Links: network.links(), Chains: certs.list(), CertDir: certs.dir, Memory: prof.memory, Mispredict: *mispredict}
+	m.Workload, _ = work.workload()
+	for _, name := range splitList(*protocols) {
+		p, err := measure.ParseProtocol(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		m.Protocols = append(m.Protocols, p)
+	}
+	for _, name := range splitList(*auths) {
+		a, err := measure.ParseAuthMode(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		m.Auths = append(m.Auths, a)
+	}
+	for _, name := range splitList(*groups) {
+		g, err := measure.ParseCurve(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		m.Groups = append(m.Groups, g)
+	}
+	for _, name := range splitList(*schemes) {
+		scheme, err := measure.ParseScheme(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		m.Schemes = append(m.Schemes, scheme)
+	}
+	resumed := false
+	for _, name := range splitList(*resumptions) {
+		r, err := measure.ParseResumption(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := measure.CheckResumption(r); err != nil {
+			log.Fatal(err)
+		}
+		m.Resumptions = append(m.Resumptions, r)
+		resumed = resumed || r != measure.NoResumption
+	}
+
+	scenarios := m.Scenarios()
+	if len(scenarios) == 0 {
+		log.Fatal("no valid combination of protocols, groups and schemes")
+	}
+
+	human, exporter, out := output.open()
+	sweep := prof.sweep(scenarios, output.warmup, output.iterations)
+	for _, sr := range sweep {
+		export(exporter, sr.Scenario, sr.Results)
+	}
+	closeExporter(exporter, out)
+	output.report(sweep)
+
+	measure.PrintComparison(human, sweep)
+	if len(m.Links) > 1 {
+		measure.PrintLatencyDistribution(human, sweep)
+	}
+	if len(m.Chains) > 1 {
+		measure.PrintChainComparison(human, sweep)
+	}
+	if m.Memory {
+		measure.PrintMemoryComparison(human, sweep)
+	}
+	if resumed {
+		measure.PrintResumptionComparison(human, sweep)
+	}
+	if m.Mispredict {
+		measure.PrintKeyShareComparison(human, sweep)
+		measure.PrintKeyShareStrategies(human, sweep, m.Groups)
+	}
+}
+
+// splitList splits a comma-separated flag value, ignoring empty elements.
+func splitList(s string) []string {
+	var list []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/claucece/KEMTLS-local-measurements/measure"
+)
+
+// workloadFlags configure the application data exchanged after the
+// handshake.
+type workloadFlags struct {
+	w measure.Workload
+}
+
+func (wf *workloadFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&wf.w.Mode, "workload", "", "application data after the handshake: pingpong, stream or echo; a single test message if empty")
+	fs.IntVar(&wf.w.Size, "size", 0, "bytes per message of the workload, the test message's length if 0")
+	fs.IntVar(&wf.w.RoundTrips, "round-trips", 0, "request and response exchanges of the pingpong workload, 1 if 0")
+}
+
+// workload returns the workload, and whether one was asked for.
+func (wf *workloadFlags) workload() (measure.Workload, bool) {
+	if _, err := measure.ParseWorkloadMode(wf.w.Mode); err != nil {
+		log.Fatal(err)
+	}
+	return wf.w, wf.w != measure.Workload{}
+}